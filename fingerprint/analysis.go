@@ -0,0 +1,397 @@
+package fingerprint
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	utls "github.com/refraction-networking/utls"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// 参与指纹计算的扩展类型
+const (
+	extServerName          uint16 = 0x0000
+	extSupportedGroups     uint16 = 0x000a
+	extECPointFormats      uint16 = 0x000b
+	extSignatureAlgorithms uint16 = 0x000d
+	extALPN                uint16 = 0x0010
+	extSupportedVersions   uint16 = 0x002b
+)
+
+// FingerprintReport 指纹分析结果
+type FingerprintReport struct {
+	JA3        string `json:"ja3"`
+	JA3Hash    string `json:"ja3_hash"`
+	JA3N       string `json:"ja3n"`
+	JA3NHash   string `json:"ja3n_hash"`
+	JA4        string `json:"ja4"`
+	Akamai     string `json:"akamai,omitempty"`
+	AkamaiHash string `json:"akamai_hash,omitempty"`
+}
+
+// ClientHelloInfo 从原始 ClientHello 中解析出的指纹相关字段
+type ClientHelloInfo struct {
+	Version             uint16   // legacy_version
+	CipherSuites        []uint16 // 含 GREASE
+	Extensions          []uint16 // 按发送顺序，含 GREASE
+	Groups              []uint16
+	PointFormats        []uint8
+	SignatureAlgorithms []uint16
+	SupportedVersions   []uint16
+	ALPN                []string
+	ServerName          string
+}
+
+// ParseClientHello 解析 ClientHello 握手消息（以握手类型字节 0x01 开头，不含记录层头部）
+func ParseClientHello(msg []byte) (*ClientHelloInfo, error) {
+	s := cryptobyte.String(msg)
+	var msgType uint8
+	var body cryptobyte.String
+	if !s.ReadUint8(&msgType) || msgType != 1 || !s.ReadUint24LengthPrefixed(&body) {
+		return nil, fmt.Errorf("不是有效的 ClientHello 消息")
+	}
+
+	info := &ClientHelloInfo{}
+	var sessionID, ciphers, compression cryptobyte.String
+	if !body.ReadUint16(&info.Version) ||
+		!body.Skip(32) ||
+		!body.ReadUint8LengthPrefixed(&sessionID) ||
+		!body.ReadUint16LengthPrefixed(&ciphers) ||
+		!body.ReadUint8LengthPrefixed(&compression) {
+		return nil, fmt.Errorf("ClientHello 格式错误")
+	}
+	for !ciphers.Empty() {
+		var id uint16
+		if !ciphers.ReadUint16(&id) {
+			return nil, fmt.Errorf("密码套件列表格式错误")
+		}
+		info.CipherSuites = append(info.CipherSuites, id)
+	}
+
+	if body.Empty() {
+		return info, nil
+	}
+	var exts cryptobyte.String
+	if !body.ReadUint16LengthPrefixed(&exts) {
+		return nil, fmt.Errorf("扩展列表格式错误")
+	}
+	for !exts.Empty() {
+		var typ uint16
+		var data cryptobyte.String
+		if !exts.ReadUint16(&typ) || !exts.ReadUint16LengthPrefixed(&data) {
+			return nil, fmt.Errorf("扩展格式错误")
+		}
+		info.Extensions = append(info.Extensions, typ)
+		if err := info.parseExtension(typ, data); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+// parseExtension 解析指纹计算需要的扩展内容
+func (info *ClientHelloInfo) parseExtension(typ uint16, data cryptobyte.String) error {
+	var list cryptobyte.String
+	switch typ {
+	case extServerName:
+		var nameType uint8
+		var name cryptobyte.String
+		if !data.ReadUint16LengthPrefixed(&list) || !list.ReadUint8(&nameType) || !list.ReadUint16LengthPrefixed(&name) {
+			return fmt.Errorf("server_name 扩展格式错误")
+		}
+		info.ServerName = string(name)
+	case extSupportedGroups, extSignatureAlgorithms:
+		if !data.ReadUint16LengthPrefixed(&list) {
+			return fmt.Errorf("扩展 %d 格式错误", typ)
+		}
+		values, ok := readUint16s(list)
+		if !ok {
+			return fmt.Errorf("扩展 %d 格式错误", typ)
+		}
+		if typ == extSupportedGroups {
+			info.Groups = values
+		} else {
+			info.SignatureAlgorithms = values
+		}
+	case extSupportedVersions:
+		if !data.ReadUint8LengthPrefixed(&list) {
+			return fmt.Errorf("supported_versions 扩展格式错误")
+		}
+		values, ok := readUint16s(list)
+		if !ok {
+			return fmt.Errorf("supported_versions 扩展格式错误")
+		}
+		info.SupportedVersions = values
+	case extECPointFormats:
+		if !data.ReadUint8LengthPrefixed(&list) {
+			return fmt.Errorf("ec_point_formats 扩展格式错误")
+		}
+		info.PointFormats = append([]uint8(nil), list...)
+	case extALPN:
+		if !data.ReadUint16LengthPrefixed(&list) {
+			return fmt.Errorf("ALPN 扩展格式错误")
+		}
+		for !list.Empty() {
+			var proto cryptobyte.String
+			if !list.ReadUint8LengthPrefixed(&proto) {
+				return fmt.Errorf("ALPN 扩展格式错误")
+			}
+			info.ALPN = append(info.ALPN, string(proto))
+		}
+	}
+	return nil
+}
+
+func readUint16s(s cryptobyte.String) ([]uint16, bool) {
+	var values []uint16
+	for !s.Empty() {
+		var v uint16
+		if !s.ReadUint16(&v) {
+			return nil, false
+		}
+		values = append(values, v)
+	}
+	return values, true
+}
+
+// isGREASE 判断是否为 GREASE 取值（RFC 8701）
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// withoutGREASE 去除 GREASE 取值
+func withoutGREASE(values []uint16) []uint16 {
+	out := make([]uint16, 0, len(values))
+	for _, v := range values {
+		if !isGREASE(v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// joinUint16 以十进制连接
+func joinUint16(values []uint16, sep string) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(int(v))
+	}
+	return strings.Join(parts, sep)
+}
+
+// JA3 返回 JA3 字符串：SSLVersion,Ciphers,Extensions,EllipticCurves,EllipticCurvePointFormats
+func (info *ClientHelloInfo) JA3() string {
+	return info.ja3(withoutGREASE(info.Extensions))
+}
+
+// JA3N 返回 JA3N 字符串（扩展按类型排序，不受 Chrome 扩展乱序影响）
+func (info *ClientHelloInfo) JA3N() string {
+	exts := withoutGREASE(info.Extensions)
+	sort.Slice(exts, func(i, j int) bool { return exts[i] < exts[j] })
+	return info.ja3(exts)
+}
+
+func (info *ClientHelloInfo) ja3(exts []uint16) string {
+	formats := make([]uint16, len(info.PointFormats))
+	for i, f := range info.PointFormats {
+		formats[i] = uint16(f)
+	}
+	return strings.Join([]string{
+		strconv.Itoa(int(info.Version)),
+		joinUint16(withoutGREASE(info.CipherSuites), "-"),
+		joinUint16(exts, "-"),
+		joinUint16(withoutGREASE(info.Groups), "-"),
+		joinUint16(formats, "-"),
+	}, ",")
+}
+
+// JA4 返回 JA4 指纹（TCP）：a_b_c
+// a：协议、TLS 版本、SNI、密码套件数、扩展数、ALPN 首尾字符；
+// b：排序后的密码套件 SHA256 前 12 位；c：排序后的扩展（不含 SNI/ALPN）与签名算法的 SHA256 前 12 位
+func (info *ClientHelloInfo) JA4() string {
+	ciphers := withoutGREASE(info.CipherSuites)
+	exts := withoutGREASE(info.Extensions)
+
+	version := info.Version
+	if versions := withoutGREASE(info.SupportedVersions); len(versions) > 0 {
+		version = versions[0]
+		for _, v := range versions {
+			version = max(version, v)
+		}
+	}
+	sni := "i"
+	if info.ServerName != "" {
+		sni = "d"
+	}
+	alpn := "00"
+	if len(info.ALPN) > 0 && info.ALPN[0] != "" {
+		first := info.ALPN[0]
+		alpn = string(first[0]) + string(first[len(first)-1])
+	}
+	a := fmt.Sprintf("t%s%s%02d%02d%s", ja4Version(version), sni, min(len(ciphers), 99), min(len(exts), 99), alpn)
+
+	sortedCiphers := append([]uint16(nil), ciphers...)
+	sort.Slice(sortedCiphers, func(i, j int) bool { return sortedCiphers[i] < sortedCiphers[j] })
+	b := ja4Hash(hexList(sortedCiphers))
+
+	var sortedExts []uint16
+	for _, e := range exts {
+		if e != extServerName && e != extALPN {
+			sortedExts = append(sortedExts, e)
+		}
+	}
+	sort.Slice(sortedExts, func(i, j int) bool { return sortedExts[i] < sortedExts[j] })
+	c := hexList(sortedExts)
+	if len(info.SignatureAlgorithms) > 0 {
+		c += "_" + hexList(info.SignatureAlgorithms)
+	}
+	c = ja4Hash(c)
+	if len(sortedExts) == 0 {
+		c = strings.Repeat("0", 12)
+	}
+
+	return a + "_" + b + "_" + c
+}
+
+// ja4Version TLS 版本的 JA4 表示
+func ja4Version(v uint16) string {
+	switch v {
+	case utls.VersionTLS13:
+		return "13"
+	case utls.VersionTLS12:
+		return "12"
+	case utls.VersionTLS11:
+		return "11"
+	case utls.VersionTLS10:
+		return "10"
+	case utls.VersionSSL30:
+		return "s3"
+	}
+	return "00"
+}
+
+// hexList 以 4 位小写十六进制、逗号连接
+func hexList(values []uint16) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprintf("%04x", v)
+	}
+	return strings.Join(parts, ",")
+}
+
+// ja4Hash SHA256 前 12 位（空输入为 12 个 0）
+func ja4Hash(s string) string {
+	if s == "" {
+		return strings.Repeat("0", 12)
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// md5Hex MD5 十六进制摘要
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// Report 计算 ClientHello 的 TLS 指纹
+func (info *ClientHelloInfo) Report() *FingerprintReport {
+	ja3, ja3n := info.JA3(), info.JA3N()
+	return &FingerprintReport{
+		JA3:      ja3,
+		JA3Hash:  md5Hex(ja3),
+		JA3N:     ja3n,
+		JA3NHash: md5Hex(ja3n),
+		JA4:      info.JA4(),
+	}
+}
+
+// Akamai 返回 Akamai HTTP/2 指纹字符串：SETTINGS|WINDOW_UPDATE|PRIORITY|伪头部顺序
+func (p *HTTP2Profile) Akamai() string {
+	settings := make([]string, len(p.Settings))
+	for i, s := range p.Settings {
+		settings[i] = fmt.Sprintf("%d:%d", s.ID, s.Val)
+	}
+	priorities := make([]string, len(p.Priorities))
+	for i, pr := range p.Priorities {
+		priorities[i] = akamaiPriority(pr.StreamID, pr.Exclusive, pr.StreamDep, pr.Weight)
+	}
+	return akamaiString(settings, p.ConnectionFlow, priorities, p.PseudoHeaderOrder)
+}
+
+// akamaiPriority 单个 PRIORITY 帧的 Akamai 表示（权重 1-256）
+func akamaiPriority(streamID uint32, exclusive bool, dep uint32, weight uint16) string {
+	excl := 0
+	if exclusive {
+		excl = 1
+	}
+	return fmt.Sprintf("%d:%d:%d:%d", streamID, excl, dep, weight)
+}
+
+// akamaiString 组合 Akamai 指纹字符串
+func akamaiString(settings []string, window uint32, priorities, pseudoOrder []string) string {
+	prio := "0"
+	if len(priorities) > 0 {
+		prio = strings.Join(priorities, ",")
+	}
+	pseudo := make([]string, 0, len(pseudoOrder))
+	for _, name := range pseudoOrder {
+		if name = strings.TrimPrefix(name, ":"); name != "" {
+			pseudo = append(pseudo, name[:1])
+		}
+	}
+	return fmt.Sprintf("%s|%d|%s|%s", strings.Join(settings, ";"), window, prio, strings.Join(pseudo, ","))
+}
+
+// BuildClientHello 离线构造指纹对应的 ClientHello 握手消息（不建立网络连接）
+// 随机化指纹与 Chrome 扩展乱序每次构造结果不同，比较时应使用 JA3N / JA4
+func BuildClientHello(profile FingerprintProfile, serverName string, nextProtos []string) ([]byte, error) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	config := &utls.Config{ServerName: serverName, NextProtos: nextProtos, OmitEmptyPsk: true}
+	var uconn *utls.UConn
+	if spec := profile.Spec; spec != nil {
+		chs, err := spec.ClientHelloSpec()
+		if err != nil {
+			return nil, err
+		}
+		uconn = utls.UClient(client, config, utls.HelloCustom)
+		if err := uconn.ApplyPreset(chs); err != nil {
+			return nil, fmt.Errorf("应用 ClientHelloSpec 失败: %w", err)
+		}
+	} else {
+		uconn = utls.UClient(client, config, profile.HelloID)
+	}
+
+	if err := uconn.BuildHandshakeState(); err != nil {
+		return nil, fmt.Errorf("构造 ClientHello 失败: %w", err)
+	}
+	return uconn.HandshakeState.Hello.Raw, nil
+}
+
+// AnalyzeProfile 计算指纹配置的 JA3、JA3N、JA4 与 Akamai HTTP/2 指纹
+func AnalyzeProfile(profile FingerprintProfile) (*FingerprintReport, error) {
+	raw, err := BuildClientHello(profile, "example.com", []string{"h2", "http/1.1"})
+	if err != nil {
+		return nil, err
+	}
+	info, err := ParseClientHello(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	report := info.Report()
+	if profile.HTTP2 != nil {
+		report.Akamai = profile.HTTP2.Akamai()
+		report.AkamaiHash = md5Hex(report.Akamai)
+	}
+	return report, nil
+}
@@ -0,0 +1,431 @@
+package fingerprint
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	utls "github.com/refraction-networking/utls"
+	"github.com/refraction-networking/utls/dicttls"
+)
+
+// greaseName GREASE 占位名称（密码套件、曲线、版本、密钥交换中通用）
+const greaseName = "GREASE"
+
+// ClientHelloSpecDef 可序列化的 ClientHello 定义（对应 utls.ClientHelloSpec，可从 JSON/YAML 加载）
+// 各名称列表使用 IANA 名称（如 "TLS_AES_128_GCM_SHA256"、"x25519"、"ecdsa_secp256r1_sha256"），
+// 也可写十六进制码点（如 "0x11ec"），以便在 utls 尚未收录时使用新的取值
+type ClientHelloSpecDef struct {
+	// TLS 版本范围（如 "1.2"、"1.3"，可选，默认由 supported_versions 推导）
+	TLSVersMin string `json:"tls_vers_min,omitempty"`
+	TLSVersMax string `json:"tls_vers_max,omitempty"`
+
+	// 密码套件（按发送顺序，"GREASE" 表示 GREASE 位置）
+	CipherSuites []string `json:"cipher_suites"`
+
+	// 压缩方法（可选，默认 ["NULL"]）
+	CompressionMethods []string `json:"compression_methods,omitempty"`
+
+	// 扩展（按发送顺序）
+	Extensions []ExtensionDef `json:"extensions"`
+
+	// 是否按 Chrome 106+ 的方式随机打乱扩展顺序（GREASE 与 padding 位置不变）
+	ShuffleExtensions bool `json:"shuffle_extensions,omitempty"`
+}
+
+// ExtensionDef 一个 TLS 扩展的定义，Name 决定使用哪些参数字段
+type ExtensionDef struct {
+	// 扩展名称（IANA 名称，如 "server_name"、"key_share"；"GREASE" 表示 GREASE 扩展）
+	Name string `json:"name"`
+
+	// application_layer_protocol_negotiation / application_settings(_new) 的协议列表
+	Protocols []string `json:"protocols,omitempty"`
+
+	// supported_groups 的曲线列表
+	Groups []string `json:"groups,omitempty"`
+
+	// key_share 的密钥交换组（"GREASE" 组携带 1 字节数据）
+	KeyShares []string `json:"key_shares,omitempty"`
+
+	// ec_point_formats 的点格式
+	PointFormats []string `json:"point_formats,omitempty"`
+
+	// signature_algorithms / signature_algorithms_cert / delegated_credentials 的签名算法
+	SignatureAlgorithms []string `json:"signature_algorithms,omitempty"`
+
+	// supported_versions 的版本列表（如 "GREASE"、"1.3"、"1.2"）
+	Versions []string `json:"versions,omitempty"`
+
+	// psk_key_exchange_modes 的模式（如 "psk_dhe_ke"）
+	PSKModes []string `json:"psk_modes,omitempty"`
+
+	// compress_certificate 的算法（如 "brotli"、"zlib"、"zstd"）
+	Algorithms []string `json:"algorithms,omitempty"`
+
+	// padding 的固定长度（0 表示 BoringSSL 风格自动填充）
+	Length int `json:"length,omitempty"`
+
+	// record_size_limit 的取值
+	Limit uint16 `json:"limit,omitempty"`
+
+	// 通用扩展：扩展 ID 与十六进制数据（用于未内置的扩展）
+	ID   uint16 `json:"id,omitempty"`
+	Data string `json:"data,omitempty"`
+}
+
+// extraGroups utls dicttls 尚未收录的曲线名称
+var extraGroups = map[string]uint16{
+	"X25519MLKEM768":        uint16(utls.X25519MLKEM768),
+	"x25519mlkem768":        uint16(utls.X25519MLKEM768),
+	"X25519Kyber768Draft00": 0x6399,
+}
+
+// Validate 校验定义的完整性与一致性
+func (d *ClientHelloSpecDef) Validate() error {
+	_, err := d.build()
+	return err
+}
+
+// ClientHelloSpec 构造 utls.ClientHelloSpec
+// 扩展对象在握手时会被修改，每次建立连接都必须调用本方法获取新的实例
+func (d *ClientHelloSpecDef) ClientHelloSpec() (*utls.ClientHelloSpec, error) {
+	return d.build()
+}
+
+// build 解析名称、构造扩展并执行一致性校验
+func (d *ClientHelloSpecDef) build() (*utls.ClientHelloSpec, error) {
+	spec := &utls.ClientHelloSpec{}
+
+	var err error
+	if spec.TLSVersMin, err = parseTLSVersion(d.TLSVersMin); err != nil {
+		return nil, err
+	}
+	if spec.TLSVersMax, err = parseTLSVersion(d.TLSVersMax); err != nil {
+		return nil, err
+	}
+	if spec.TLSVersMin != 0 && spec.TLSVersMax != 0 && spec.TLSVersMin > spec.TLSVersMax {
+		return nil, fmt.Errorf("tls_vers_min 大于 tls_vers_max")
+	}
+
+	if len(d.CipherSuites) == 0 {
+		return nil, fmt.Errorf("cipher_suites 不能为空")
+	}
+	seenCiphers := make(map[uint16]bool)
+	for _, name := range d.CipherSuites {
+		if name == greaseName {
+			spec.CipherSuites = append(spec.CipherSuites, utls.GREASE_PLACEHOLDER)
+			continue
+		}
+		id, err := lookupCode(dicttls.DictCipherSuiteNameIndexed, name, "密码套件")
+		if err != nil {
+			return nil, err
+		}
+		if seenCiphers[id] {
+			return nil, fmt.Errorf("密码套件重复: %s", name)
+		}
+		seenCiphers[id] = true
+		spec.CipherSuites = append(spec.CipherSuites, id)
+	}
+
+	methods := d.CompressionMethods
+	if len(methods) == 0 {
+		methods = []string{"NULL"}
+	}
+	for _, name := range methods {
+		id, err := lookupCode(dicttls.DictCompMethNameIndexed, name, "压缩方法")
+		if err != nil {
+			return nil, err
+		}
+		spec.CompressionMethods = append(spec.CompressionMethods, id)
+	}
+
+	if len(d.Extensions) == 0 {
+		return nil, fmt.Errorf("extensions 不能为空")
+	}
+	seenExts := make(map[string]bool)
+	greaseExts := 0
+	for i := range d.Extensions {
+		def := &d.Extensions[i]
+		if def.Name == greaseName {
+			if greaseExts++; greaseExts > 2 {
+				return nil, fmt.Errorf("GREASE 扩展最多出现 2 次")
+			}
+		} else if def.Name != "generic" {
+			if seenExts[def.Name] {
+				return nil, fmt.Errorf("扩展重复: %s", def.Name)
+			}
+			seenExts[def.Name] = true
+		}
+
+		ext, err := def.build()
+		if err != nil {
+			return nil, fmt.Errorf("扩展 %s 无效: %w", def.Name, err)
+		}
+		spec.Extensions = append(spec.Extensions, ext)
+	}
+
+	if err := checkSpecConsistency(spec); err != nil {
+		return nil, err
+	}
+
+	if d.ShuffleExtensions {
+		spec.Extensions = utls.ShuffleChromeTLSExtensions(spec.Extensions)
+	}
+	return spec, nil
+}
+
+// build 构造单个扩展
+func (e *ExtensionDef) build() (utls.TLSExtension, error) {
+	switch e.Name {
+	case greaseName:
+		return &utls.UtlsGREASEExtension{}, nil
+	case "server_name":
+		return &utls.SNIExtension{}, nil
+	case "extended_master_secret":
+		return &utls.ExtendedMasterSecretExtension{}, nil
+	case "renegotiation_info":
+		return &utls.RenegotiationInfoExtension{Renegotiation: utls.RenegotiateOnceAsClient}, nil
+	case "session_ticket":
+		return &utls.SessionTicketExtension{}, nil
+	case "status_request":
+		return &utls.StatusRequestExtension{}, nil
+	case "signed_certificate_timestamp":
+		return &utls.SCTExtension{}, nil
+	case "encrypted_client_hello":
+		// 与 Chrome 一致的 GREASE ECH
+		return utls.BoringGREASEECH(), nil
+	case "supported_groups":
+		groups, err := lookupGroups(e.Groups)
+		if err != nil {
+			return nil, err
+		}
+		return &utls.SupportedCurvesExtension{Curves: groups}, nil
+	case "key_share":
+		groups, err := lookupGroups(e.KeyShares)
+		if err != nil {
+			return nil, err
+		}
+		shares := make([]utls.KeyShare, 0, len(groups))
+		for _, g := range groups {
+			share := utls.KeyShare{Group: g}
+			if g == utls.GREASE_PLACEHOLDER {
+				share.Data = []byte{0}
+			}
+			shares = append(shares, share)
+		}
+		return &utls.KeyShareExtension{KeyShares: shares}, nil
+	case "ec_point_formats":
+		formats, err := lookupCodes(dicttls.DictECPointFormatNameIndexed, e.PointFormats, "点格式")
+		if err != nil {
+			return nil, err
+		}
+		return &utls.SupportedPointsExtension{SupportedPoints: formats}, nil
+	case "signature_algorithms", "signature_algorithms_cert", "delegated_credentials":
+		schemes, err := lookupCodes(dicttls.DictSignatureSchemeNameIndexed, e.SignatureAlgorithms, "签名算法")
+		if err != nil {
+			return nil, err
+		}
+		algs := make([]utls.SignatureScheme, 0, len(schemes))
+		for _, s := range schemes {
+			algs = append(algs, utls.SignatureScheme(s))
+		}
+		switch e.Name {
+		case "signature_algorithms":
+			return &utls.SignatureAlgorithmsExtension{SupportedSignatureAlgorithms: algs}, nil
+		case "signature_algorithms_cert":
+			return &utls.SignatureAlgorithmsCertExtension{SupportedSignatureAlgorithms: algs}, nil
+		default:
+			return &utls.FakeDelegatedCredentialsExtension{SupportedSignatureAlgorithms: algs}, nil
+		}
+	case "application_layer_protocol_negotiation":
+		if len(e.Protocols) == 0 {
+			return nil, fmt.Errorf("protocols 不能为空")
+		}
+		return &utls.ALPNExtension{AlpnProtocols: e.Protocols}, nil
+	case "application_settings":
+		return &utls.ApplicationSettingsExtension{SupportedProtocols: e.Protocols}, nil
+	case "application_settings_new":
+		return &utls.ApplicationSettingsExtensionNew{SupportedProtocols: e.Protocols}, nil
+	case "supported_versions":
+		if len(e.Versions) == 0 {
+			return nil, fmt.Errorf("versions 不能为空")
+		}
+		versions := make([]uint16, 0, len(e.Versions))
+		for _, v := range e.Versions {
+			if v == greaseName {
+				versions = append(versions, utls.GREASE_PLACEHOLDER)
+				continue
+			}
+			ver, err := parseTLSVersion(v)
+			if err != nil {
+				return nil, err
+			}
+			versions = append(versions, ver)
+		}
+		return &utls.SupportedVersionsExtension{Versions: versions}, nil
+	case "psk_key_exchange_modes":
+		modes, err := lookupCodes(dicttls.DictPSKKeyExchangeModeNameIndexed, e.PSKModes, "PSK 模式")
+		if err != nil {
+			return nil, err
+		}
+		return &utls.PSKKeyExchangeModesExtension{Modes: modes}, nil
+	case "compress_certificate":
+		ids, err := lookupCodes(dicttls.DictCertificateCompressionAlgorithmNameIndexed, e.Algorithms, "证书压缩算法")
+		if err != nil {
+			return nil, err
+		}
+		algs := make([]utls.CertCompressionAlgo, 0, len(ids))
+		for _, id := range ids {
+			algs = append(algs, utls.CertCompressionAlgo(id))
+		}
+		return &utls.UtlsCompressCertExtension{Algorithms: algs}, nil
+	case "record_size_limit":
+		if e.Limit == 0 {
+			return nil, fmt.Errorf("limit 不能为 0")
+		}
+		return &utls.FakeRecordSizeLimitExtension{Limit: e.Limit}, nil
+	case "padding":
+		if e.Length > 0 {
+			return &utls.UtlsPaddingExtension{PaddingLen: e.Length, WillPad: true}, nil
+		}
+		return &utls.UtlsPaddingExtension{GetPaddingLen: utls.BoringPaddingStyle}, nil
+	case "generic":
+		data, err := hex.DecodeString(e.Data)
+		if err != nil {
+			return nil, fmt.Errorf("data 不是有效的十六进制: %w", err)
+		}
+		return &utls.GenericExtension{Id: e.ID, Data: data}, nil
+	case "pre_shared_key":
+		return nil, fmt.Errorf("不支持 pre_shared_key（需要会话恢复状态）")
+	}
+	return nil, fmt.Errorf("未知扩展")
+}
+
+// checkSpecConsistency 校验扩展之间的一致性
+func checkSpecConsistency(spec *utls.ClientHelloSpec) error {
+	var (
+		groups    map[utls.CurveID]bool
+		keyShares []utls.KeyShare
+		alpn      []string
+		alps      []string
+		tls13     bool
+	)
+	for _, ext := range spec.Extensions {
+		switch e := ext.(type) {
+		case *utls.SupportedCurvesExtension:
+			groups = make(map[utls.CurveID]bool, len(e.Curves))
+			for _, c := range e.Curves {
+				groups[c] = true
+			}
+		case *utls.KeyShareExtension:
+			keyShares = e.KeyShares
+		case *utls.ALPNExtension:
+			alpn = e.AlpnProtocols
+		case *utls.ApplicationSettingsExtension:
+			alps = e.SupportedProtocols
+		case *utls.ApplicationSettingsExtensionNew:
+			alps = e.SupportedProtocols
+		case *utls.SupportedVersionsExtension:
+			for _, v := range e.Versions {
+				tls13 = tls13 || v == utls.VersionTLS13
+			}
+		}
+	}
+
+	if tls13 && len(keyShares) == 0 {
+		return fmt.Errorf("supported_versions 包含 TLS 1.3 时必须提供 key_share")
+	}
+	if len(keyShares) > 0 && groups == nil {
+		return fmt.Errorf("key_share 需要同时提供 supported_groups")
+	}
+	for _, ks := range keyShares {
+		if ks.Group != utls.GREASE_PLACEHOLDER && !groups[ks.Group] {
+			return fmt.Errorf("key_share 中的组 0x%04x 不在 supported_groups 中", uint16(ks.Group))
+		}
+	}
+	for _, p := range alps {
+		found := false
+		for _, a := range alpn {
+			found = found || a == p
+		}
+		if !found {
+			return fmt.Errorf("application_settings 协议 %s 不在 ALPN 中", p)
+		}
+	}
+	return nil
+}
+
+// lookupGroups 解析曲线名称列表
+func lookupGroups(names []string) ([]utls.CurveID, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("曲线列表不能为空")
+	}
+	groups := make([]utls.CurveID, 0, len(names))
+	for _, name := range names {
+		if name == greaseName {
+			groups = append(groups, utls.GREASE_PLACEHOLDER)
+			continue
+		}
+		id, ok := extraGroups[name]
+		if !ok {
+			var err error
+			if id, err = lookupCode(dicttls.DictSupportedGroupsNameIndexed, name, "曲线"); err != nil {
+				return nil, err
+			}
+		}
+		groups = append(groups, utls.CurveID(id))
+	}
+	return groups, nil
+}
+
+// lookupCodes 批量解析名称为码点
+func lookupCodes[T uint8 | uint16](dict map[string]T, names []string, kind string) ([]T, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%s列表不能为空", kind)
+	}
+	codes := make([]T, 0, len(names))
+	for _, name := range names {
+		code, err := lookupCode(dict, name, kind)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// lookupCode 解析名称为码点：支持字典名称与十六进制码点（GREASE 由调用方处理）
+func lookupCode[T uint8 | uint16](dict map[string]T, name, kind string) (T, error) {
+	if code, ok := dict[name]; ok {
+		return code, nil
+	}
+	if hexStr, ok := strings.CutPrefix(strings.ToLower(name), "0x"); ok {
+		var zero T
+		bits := 8
+		if uint16(^zero) > 0xff {
+			bits = 16
+		}
+		if v, err := strconv.ParseUint(hexStr, 16, bits); err == nil {
+			return T(v), nil
+		}
+	}
+	return 0, fmt.Errorf("未知的%s: %s", kind, name)
+}
+
+// parseTLSVersion 解析 TLS 版本（"1.0"-"1.3"，可带 "TLS " 前缀；空字符串返回 0）
+func parseTLSVersion(s string) (uint16, error) {
+	switch strings.TrimPrefix(strings.TrimSpace(s), "TLS ") {
+	case "":
+		return 0, nil
+	case "1.0":
+		return utls.VersionTLS10, nil
+	case "1.1":
+		return utls.VersionTLS11, nil
+	case "1.2":
+		return utls.VersionTLS12, nil
+	case "1.3":
+		return utls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("未知的 TLS 版本: %s", s)
+}
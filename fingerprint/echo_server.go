@@ -0,0 +1,348 @@
+package fingerprint
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// EchoReport 回显服务器捕获到的一次请求的指纹
+type EchoReport struct {
+	FingerprintReport
+	Protocol   string   `json:"protocol"` // 协商的 ALPN（h2 或 http/1.1）
+	ServerName string   `json:"server_name"`
+	ALPN       []string `json:"alpn"`
+	UserAgent  string   `json:"user_agent"`
+}
+
+// EchoServer 本地 TLS 回显服务器
+// 捕获客户端发送的原始 ClientHello（以及 HTTP/2 连接前言），将计算出的指纹以 JSON 返回，
+// 用于在不访问外网的情况下校验客户端实际发送的指纹
+type EchoServer struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+	reports   chan *EchoReport
+	wg        sync.WaitGroup
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+// NewEchoServer 在 127.0.0.1 的随机端口启动回显服务器（使用运行时生成的自签名证书）
+func NewEchoServer() (*EchoServer, error) {
+	cert, err := selfSignedCert()
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("监听失败: %w", err)
+	}
+
+	s := &EchoServer{
+		listener: listener,
+		tlsConfig: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			NextProtos:   []string{"h2", "http/1.1"},
+		},
+		reports: make(chan *EchoReport, 64),
+		conns:   make(map[net.Conn]struct{}),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr 返回监听地址
+func (s *EchoServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// URL 返回回显服务器的 https 地址
+func (s *EchoServer) URL() string {
+	return "https://" + s.Addr()
+}
+
+// Reports 返回捕获到的指纹（缓冲区满时丢弃）
+func (s *EchoServer) Reports() <-chan *EchoReport {
+	return s.reports
+}
+
+// Close 关闭服务器与所有连接
+func (s *EchoServer) Close() error {
+	err := s.listener.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *EchoServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+				conn.Close()
+			}()
+			s.handleConn(conn)
+		}()
+	}
+}
+
+// handleConn 捕获 ClientHello 后完成 TLS 握手并按协商的协议回显
+func (s *EchoServer) handleConn(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	records, hello, err := readClientHello(conn)
+	if err != nil {
+		return
+	}
+	info, err := ParseClientHello(hello)
+	if err != nil {
+		return
+	}
+
+	// 将已读取的记录重新交给 TLS 服务端
+	tlsConn := tls.Server(&replayConn{Conn: conn, r: io.MultiReader(bytes.NewReader(records), conn)}, s.tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		return
+	}
+
+	base := EchoReport{
+		FingerprintReport: *info.Report(),
+		Protocol:          tlsConn.ConnectionState().NegotiatedProtocol,
+		ServerName:        info.ServerName,
+		ALPN:              info.ALPN,
+	}
+	if base.Protocol == "h2" {
+		s.serveH2(tlsConn, base)
+	} else {
+		s.serveH1(tlsConn, base)
+	}
+}
+
+// publish 非阻塞地投递指纹
+func (s *EchoServer) publish(report EchoReport) []byte {
+	select {
+	case s.reports <- &report:
+	default:
+	}
+	body, _ := json.Marshal(&report)
+	return body
+}
+
+// serveH1 以 HTTP/1.1 回显
+func (s *EchoServer) serveH1(conn net.Conn, base EchoReport) {
+	br := bufio.NewReader(conn)
+	for {
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			return
+		}
+		io.Copy(io.Discard, req.Body)
+		req.Body.Close()
+
+		report := base
+		report.UserAgent = req.UserAgent()
+		body := s.publish(report)
+
+		resp := &http.Response{
+			StatusCode:    http.StatusOK,
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": {"application/json"}},
+			ContentLength: int64(len(body)),
+			Body:          io.NopCloser(bytes.NewReader(body)),
+		}
+		if err := resp.Write(conn); err != nil {
+			return
+		}
+	}
+}
+
+// serveH2 解析 HTTP/2 连接前言计算 Akamai 指纹，并对每个请求回显
+func (s *EchoServer) serveH2(conn net.Conn, base EchoReport) {
+	preface := make([]byte, len(http2.ClientPreface))
+	if _, err := io.ReadFull(conn, preface); err != nil || string(preface) != http2.ClientPreface {
+		return
+	}
+
+	framer := http2.NewFramer(conn, conn)
+	framer.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	if err := framer.WriteSettings(); err != nil {
+		return
+	}
+
+	var (
+		settings   []string
+		window     uint32
+		priorities []string
+		akamai     string
+		encBuf     bytes.Buffer
+		encoder    = hpack.NewEncoder(&encBuf)
+	)
+	for {
+		frame, err := framer.ReadFrame()
+		if err != nil {
+			return
+		}
+		switch f := frame.(type) {
+		case *http2.SettingsFrame:
+			if f.IsAck() {
+				continue
+			}
+			if akamai == "" {
+				f.ForeachSetting(func(setting http2.Setting) error {
+					settings = append(settings, fmt.Sprintf("%d:%d", setting.ID, setting.Val))
+					return nil
+				})
+			}
+			if err := framer.WriteSettingsAck(); err != nil {
+				return
+			}
+		case *http2.WindowUpdateFrame:
+			if f.StreamID == 0 && akamai == "" {
+				window += f.Increment
+			}
+		case *http2.PriorityFrame:
+			if akamai == "" {
+				priorities = append(priorities, akamaiPriority(f.StreamID, f.Exclusive, f.StreamDep, uint16(f.Weight)+1))
+			}
+		case *http2.PingFrame:
+			if !f.IsAck() {
+				framer.WritePing(true, f.Data)
+			}
+		case *http2.GoAwayFrame:
+			return
+		case *http2.MetaHeadersFrame:
+			var pseudo []string
+			for _, field := range f.Fields {
+				if field.IsPseudo() {
+					pseudo = append(pseudo, field.Name)
+				}
+			}
+			if akamai == "" {
+				akamai = akamaiString(settings, window, priorities, pseudo)
+			}
+
+			report := base
+			report.Akamai = akamai
+			report.AkamaiHash = md5Hex(akamai)
+			for _, field := range f.RegularFields() {
+				if field.Name == "user-agent" {
+					report.UserAgent = field.Value
+				}
+			}
+			body := s.publish(report)
+
+			encBuf.Reset()
+			encoder.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+			encoder.WriteField(hpack.HeaderField{Name: "content-type", Value: "application/json"})
+			encoder.WriteField(hpack.HeaderField{Name: "content-length", Value: strconv.Itoa(len(body))})
+			if err := framer.WriteHeaders(http2.HeadersFrameParam{
+				StreamID:      f.StreamID,
+				BlockFragment: encBuf.Bytes(),
+				EndHeaders:    true,
+			}); err != nil {
+				return
+			}
+			if err := framer.WriteData(f.StreamID, true, body); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readClientHello 读取构成 ClientHello 的 TLS 记录，返回原始记录与重组后的握手消息
+func readClientHello(r io.Reader) (records, hello []byte, err error) {
+	var header [5]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, nil, err
+		}
+		if header[0] != 0x16 {
+			return nil, nil, fmt.Errorf("不是 TLS 握手记录")
+		}
+		fragment := make([]byte, binary.BigEndian.Uint16(header[3:]))
+		if _, err := io.ReadFull(r, fragment); err != nil {
+			return nil, nil, err
+		}
+		records = append(records, header[:]...)
+		records = append(records, fragment...)
+		hello = append(hello, fragment...)
+
+		if len(hello) >= 4 {
+			size := int(hello[1])<<16 | int(hello[2])<<8 | int(hello[3])
+			if len(hello) >= 4+size {
+				return records, hello[:4+size], nil
+			}
+		}
+	}
+}
+
+// replayConn 先返回已读取的数据，再从底层连接读取
+type replayConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *replayConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// selfSignedCert 生成 127.0.0.1 / localhost 的自签名证书
+func selfSignedCert() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("生成密钥失败: %w", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "utls_client echo server"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost", "example.com"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("生成证书失败: %w", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
@@ -0,0 +1,193 @@
+package fingerprint
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	utls "github.com/refraction-networking/utls"
+	"golang.org/x/net/http2"
+)
+
+// TestLoadProfilesYAML 测试从 YAML 加载 ClientHelloSpec 并与 utls 内置 Chrome 133 对比
+func TestLoadProfilesYAML(t *testing.T) {
+	profiles, err := LoadProfiles("profiles/chrome_133.yaml")
+	if err != nil {
+		t.Fatalf("加载失败: %v", err)
+	}
+	if len(profiles) != 1 {
+		t.Fatalf("指纹数量 = %d, 期望 1", len(profiles))
+	}
+	profile := profiles[0]
+	if profile.HTTP2 != HTTP2Chrome117 || profile.HelloID.Client != "Chrome" {
+		t.Fatalf("指纹元数据错误: %+v", profile)
+	}
+
+	got, err := profile.Spec.ClientHelloSpec()
+	if err != nil {
+		t.Fatalf("构造 Spec 失败: %v", err)
+	}
+	want, err := utls.UTLSIdToSpec(utls.HelloChrome_133)
+	if err != nil {
+		t.Fatalf("获取内置 Spec 失败: %v", err)
+	}
+	if !reflect.DeepEqual(got.CipherSuites, want.CipherSuites) {
+		t.Fatalf("密码套件 = %v, 期望 %v", got.CipherSuites, want.CipherSuites)
+	}
+	// 扩展顺序被打乱，比较类型集合
+	if a, b := extensionTypes(got.Extensions), extensionTypes(want.Extensions); a != b {
+		t.Fatalf("扩展 = %s, 期望 %s", a, b)
+	}
+}
+
+// TestSpecValidation 测试 ClientHelloSpec 定义校验
+func TestSpecValidation(t *testing.T) {
+	const base = `{"profiles": [{"name": "t", "browser": "Chrome", "version": "1", "spec": {
+		"cipher_suites": ["TLS_AES_128_GCM_SHA256"],
+		"extensions": [
+			{"name": "supported_groups", "groups": ["x25519"]},
+			{"name": "key_share", "key_shares": [%s]},
+			{"name": "supported_versions", "versions": ["1.3"]}%s
+		]}}]}`
+
+	cases := []struct {
+		name   string
+		json   string
+		errStr string
+	}{
+		{"有效", fmt.Sprintf(base, `"x25519"`, ""), ""},
+		{"十六进制码点", fmt.Sprintf(base, `"0x001d"`, ""), ""},
+		{"密钥交换组不在曲线中", fmt.Sprintf(base, `"secp256r1"`, ""), "不在 supported_groups"},
+		{"未知曲线", fmt.Sprintf(base, `"nope"`, ""), "未知的曲线"},
+		{"重复扩展", fmt.Sprintf(base, `"x25519"`, `, {"name": "supported_versions", "versions": ["1.2"]}`), "扩展重复"},
+		{"未知扩展", fmt.Sprintf(base, `"x25519"`, `, {"name": "nope"}`), "未知扩展"},
+		{"ALPS 不在 ALPN 中", fmt.Sprintf(base, `"x25519"`, `, {"name": "application_settings", "protocols": ["h2"]}`), "不在 ALPN 中"},
+	}
+	for _, tc := range cases {
+		_, err := ParseProfiles([]byte(tc.json), "json")
+		if tc.errStr == "" {
+			if err != nil {
+				t.Fatalf("%s: 期望成功，实际 %v", tc.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.errStr) {
+			t.Fatalf("%s: 期望错误包含 %q，实际 %v", tc.name, tc.errStr, err)
+		}
+	}
+}
+
+// TestProfileFingerprints 测试所有内置指纹的 JA3N/JA4 稳定，且与回显服务器捕获的一致
+func TestProfileFingerprints(t *testing.T) {
+	server, err := NewEchoServer()
+	if err != nil {
+		t.Fatalf("启动回显服务器失败: %v", err)
+	}
+	defer server.Close()
+
+	for _, profile := range NewFingerprintLibrary().GetAllProfiles() {
+		if profile.Browser == "Random" {
+			continue
+		}
+		first, err := AnalyzeProfile(profile)
+		if err != nil {
+			t.Fatalf("%s: 分析失败: %v", profile.Name, err)
+		}
+		second, err := AnalyzeProfile(profile)
+		if err != nil {
+			t.Fatalf("%s: 分析失败: %v", profile.Name, err)
+		}
+		if first.JA3N != second.JA3N || first.JA4 != second.JA4 {
+			t.Fatalf("%s: 指纹不稳定: %s / %s", profile.Name, first.JA4, second.JA4)
+		}
+
+		captured := echoHandshake(t, server, profile)
+		if captured.JA3N != first.JA3N || captured.JA4 != first.JA4 {
+			t.Fatalf("%s: 实际发送的指纹 %s 与分析结果 %s 不一致", profile.Name, captured.JA4, first.JA4)
+		}
+		if captured.ServerName != "example.com" {
+			t.Fatalf("%s: SNI = %q", profile.Name, captured.ServerName)
+		}
+	}
+}
+
+// TestKnownFingerprints 测试已知指纹的 JA4 与 Akamai 值
+func TestKnownFingerprints(t *testing.T) {
+	report, err := AnalyzeProfile(FingerprintProfile{HelloID: utls.HelloChrome_133, HTTP2: HTTP2Chrome117})
+	if err != nil {
+		t.Fatalf("分析失败: %v", err)
+	}
+	if !strings.HasPrefix(report.JA4, "t13d1516h2_8daaf6152771_") {
+		t.Fatalf("Chrome 133 JA4 = %s", report.JA4)
+	}
+	if want := "1:65536;2:0;4:6291456;6:262144|15663105|0|m,a,s,p"; report.Akamai != want {
+		t.Fatalf("Chrome Akamai = %s, 期望 %s", report.Akamai, want)
+	}
+	if want := "1:65536;4:131072;5:16384|12517377|3:0:0:201,5:0:0:101,7:0:0:1,9:0:7:1,11:0:3:1,13:0:0:241|m,p,a,s"; HTTP2Firefox.Akamai() != want {
+		t.Fatalf("Firefox Akamai = %s, 期望 %s", HTTP2Firefox.Akamai(), want)
+	}
+}
+
+// echoHandshake 以指纹握手连接回显服务器并返回捕获的指纹
+func echoHandshake(t *testing.T, server *EchoServer, profile FingerprintProfile) *EchoReport {
+	t.Helper()
+	conn, err := net.Dial("tcp", server.Addr())
+	if err != nil {
+		t.Fatalf("连接失败: %v", err)
+	}
+	defer conn.Close()
+
+	config := &utls.Config{ServerName: "example.com", NextProtos: []string{"h2", "http/1.1"}, InsecureSkipVerify: true, OmitEmptyPsk: true}
+	uconn := utls.UClient(conn, config, profile.HelloID)
+	if profile.Spec != nil {
+		spec, err := profile.Spec.ClientHelloSpec()
+		if err != nil {
+			t.Fatalf("构造 Spec 失败: %v", err)
+		}
+		uconn = utls.UClient(conn, config, utls.HelloCustom)
+		if err := uconn.ApplyPreset(spec); err != nil {
+			t.Fatalf("应用 Spec 失败: %v", err)
+		}
+	}
+	if err := uconn.Handshake(); err != nil {
+		t.Fatalf("%s: 握手失败: %v", profile.Name, err)
+	}
+
+	req, _ := http.NewRequest("GET", "https://example.com/", nil)
+	var resp *http.Response
+	if uconn.ConnectionState().NegotiatedProtocol == "h2" {
+		cc, err := (&http2.Transport{}).NewClientConn(uconn)
+		if err != nil {
+			t.Fatalf("%s: 创建 HTTP/2 连接失败: %v", profile.Name, err)
+		}
+		resp, err = cc.RoundTrip(req)
+	} else if err = req.Write(uconn); err == nil {
+		resp, err = http.ReadResponse(bufio.NewReader(uconn), req)
+	}
+	if err != nil {
+		t.Fatalf("%s: 请求失败: %v", profile.Name, err)
+	}
+	defer resp.Body.Close()
+
+	var report EchoReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatalf("%s: 解析回显失败: %v", profile.Name, err)
+	}
+	return &report
+}
+
+// extensionTypes 返回排序后的扩展类型列表
+func extensionTypes(exts []utls.TLSExtension) string {
+	names := make([]string, 0, len(exts))
+	for _, ext := range exts {
+		names = append(names, reflect.TypeOf(ext).String())
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
@@ -10,13 +10,15 @@ import (
 
 // FingerprintProfile 表示一个完整的浏览器指纹配置
 type FingerprintProfile struct {
-	Name        string             // 指纹名称
-	HelloID     utls.ClientHelloID // uTLS 指纹ID
-	UserAgent   string             // 对应的 User-Agent
-	Description string             // 描述
-	Platform    string             // 平台类型
-	Browser     string             // 浏览器类型
-	Version     string             // 版本号
+	Name        string              // 指纹名称
+	HelloID     utls.ClientHelloID  // uTLS 指纹ID
+	UserAgent   string              // 对应的 User-Agent
+	Description string              // 描述
+	Platform    string              // 平台类型
+	Browser     string              // 浏览器类型
+	Version     string              // 版本号
+	HTTP2       *HTTP2Profile       // HTTP/2 连接指纹（与 HelloID 对应的浏览器一致）
+	Spec        *ClientHelloSpecDef // 自定义 ClientHello（为空时使用 utls 内置指纹）
 }
 
 // FingerprintLibrary 指纹库管理器
@@ -373,6 +375,11 @@ func (lib *FingerprintLibrary) initProfiles() {
 			Version:     "random",
 		},
 	}
+
+	// 为每个指纹附加与其浏览器匹配的 HTTP/2 指纹
+	for i := range lib.profiles {
+		lib.profiles[i].HTTP2 = HTTP2ProfileFor(lib.profiles[i].HelloID)
+	}
 }
 
 // GetAllProfiles 获取所有指纹配置
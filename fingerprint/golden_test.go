@@ -0,0 +1,115 @@
+package fingerprint_test
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"utls_client/fingerprint"
+	clientLib "utls_client/lib"
+)
+
+// 内置 HTTP/2 指纹的 Akamai 值
+const (
+	akamaiChrome117    = "1:65536;2:0;4:6291456;6:262144|15663105|0|m,a,s,p"
+	akamaiChrome106    = "1:65536;2:0;3:1000;4:6291456;6:262144|15663105|0|m,a,s,p"
+	akamaiChromeLegacy = "1:65536;3:1000;4:6291456;6:262144|15663105|0|m,a,s,p"
+	akamaiFirefox      = "1:65536;4:131072;5:16384|12517377|3:0:0:201,5:0:0:101,7:0:0:1,9:0:7:1,11:0:3:1,13:0:0:241|m,p,a,s"
+	akamaiSafari       = "4:4194304;3:100|10485760|0|m,s,p,a"
+)
+
+// goldenFingerprints 指纹库中每个非随机指纹的期望值（JA3N 哈希、JA4、Akamai）
+// 升级 utls 或修改指纹库导致变化时，需确认新值与真实浏览器一致后再更新
+var goldenFingerprints = []struct {
+	name, ja3n, ja4, akamai string
+}{
+	{"Chrome 133 - Windows", "8e19337e7524d2573be54efb2b0784c9", "t13d1516h2_8daaf6152771_d8a2da3f94cd", akamaiChrome117},
+	{"Chrome 133 - macOS", "8e19337e7524d2573be54efb2b0784c9", "t13d1516h2_8daaf6152771_d8a2da3f94cd", akamaiChrome117},
+	{"Chrome 131 - Windows", "dee19b855b658c6aa0f575eda2525e19", "t13d1516h2_8daaf6152771_02713d6af862", akamaiChrome117},
+	{"Chrome 131 - macOS", "dee19b855b658c6aa0f575eda2525e19", "t13d1516h2_8daaf6152771_02713d6af862", akamaiChrome117},
+	{"Chrome 120 - Windows", "473f0e7c0b6a0f7b049072f4e683068b", "t13d1516h2_8daaf6152771_02713d6af862", akamaiChrome117},
+	{"Chrome 120 - Linux", "473f0e7c0b6a0f7b049072f4e683068b", "t13d1516h2_8daaf6152771_02713d6af862", akamaiChrome117},
+	{"Chrome 115 PQ - Windows", "3467ad436e2fe699dbf70201e4df5c59", "t13d1515h2_8daaf6152771_f37e75b10bcc", akamaiChrome106},
+	{"Chrome 114 - Windows", "aa56c057ad164ec4fdcb7a5a283be9fc", "t13d1516h2_8daaf6152771_e5627efa2ab1", akamaiChrome106},
+	{"Chrome 112 - Windows", "944aa4dad3767a77927544d3b2ed3942", "t13d1515h2_8daaf6152771_f37e75b10bcc", akamaiChrome106},
+	{"Chrome 106 Shuffle - Windows", "aa56c057ad164ec4fdcb7a5a283be9fc", "t13d1516h2_8daaf6152771_e5627efa2ab1", akamaiChrome106},
+	{"Chrome 102 - Windows", "aa56c057ad164ec4fdcb7a5a283be9fc", "t13d1516h2_8daaf6152771_e5627efa2ab1", akamaiChromeLegacy},
+	{"Chrome 100 - Windows", "aa56c057ad164ec4fdcb7a5a283be9fc", "t13d1516h2_8daaf6152771_e5627efa2ab1", akamaiChromeLegacy},
+	{"Chrome 96 - Windows", "aa56c057ad164ec4fdcb7a5a283be9fc", "t13d1516h2_8daaf6152771_e5627efa2ab1", akamaiChromeLegacy},
+	{"Chrome 87 - Windows", "821cb817a47514f1db4ece75531b7610", "t13d1515h2_8daaf6152771_de4a06bb82e3", akamaiChromeLegacy},
+	{"Chrome 83 - Windows", "821cb817a47514f1db4ece75531b7610", "t13d1515h2_8daaf6152771_de4a06bb82e3", akamaiChromeLegacy},
+	{"Chrome Auto - Windows", "8e19337e7524d2573be54efb2b0784c9", "t13d1516h2_8daaf6152771_d8a2da3f94cd", akamaiChrome117},
+	{"Firefox 120 - Windows", "6de49d1869679eda9dccc6c9057cfd94", "t13d1715h2_5b57614c22b0_5c2c66f702b0", akamaiFirefox},
+	{"Firefox 120 - macOS", "6de49d1869679eda9dccc6c9057cfd94", "t13d1715h2_5b57614c22b0_5c2c66f702b0", akamaiFirefox},
+	{"Firefox 105 - Windows", "b1efda11c805621e0f9cdc311958cb8c", "t13d1715h2_5b57614c22b0_3d5424432f57", akamaiFirefox},
+	{"Firefox 102 - Windows", "b1efda11c805621e0f9cdc311958cb8c", "t13d1715h2_5b57614c22b0_3d5424432f57", akamaiFirefox},
+	{"Firefox 99 - Windows", "77199898c94ac0d8653ed34689a71a61", "t13d1815h2_e8a523a41297_3d5424432f57", akamaiFirefox},
+	{"Firefox 65 - Windows", "ec919f75452313e106af2397bdc09497", "t13d1814h2_29a2cd9e9f10_d267a5f792d4", akamaiFirefox},
+	{"Firefox 63 - Windows", "ec919f75452313e106af2397bdc09497", "t13d1814h2_29a2cd9e9f10_d267a5f792d4", akamaiFirefox},
+	{"Firefox 56 - Windows", "2e29f068299d6fa68797b0b6c0022209", "t12d1509h2_073e58a039a6_e70312a1ce2c", akamaiFirefox},
+	{"Firefox 55 - Windows", "2e29f068299d6fa68797b0b6c0022209", "t12d1509h2_073e58a039a6_e70312a1ce2c", akamaiFirefox},
+	{"Firefox Auto - Windows", "6de49d1869679eda9dccc6c9057cfd94", "t13d1715h2_5b57614c22b0_5c2c66f702b0", akamaiFirefox},
+	{"Edge 106 - Windows", "aa56c057ad164ec4fdcb7a5a283be9fc", "t13d1516h2_8daaf6152771_e5627efa2ab1", akamaiChrome106},
+	{"Edge 85 - Windows", "821cb817a47514f1db4ece75531b7610", "t13d1515h2_8daaf6152771_de4a06bb82e3", akamaiChromeLegacy},
+	{"Edge Auto - Windows", "821cb817a47514f1db4ece75531b7610", "t13d1515h2_8daaf6152771_de4a06bb82e3", akamaiChromeLegacy},
+	{"Safari 17 - macOS", "44f7ed5185d22c92b96da72dbe68d307", "t13d2014h2_a09f3c656075_14788d8d241b", akamaiSafari},
+	{"iOS Safari 14 - iPhone", "4e732e0294d23442159b756947e9daba", "t13d2613h2_2802a3db6c62_845d286b0d67", akamaiSafari},
+	{"iOS Safari 13 - iPhone", "d672e68bc23f37c1537fdc8c17d55b66", "t13d2613h2_2802a3db6c62_845d286b0d67", akamaiSafari},
+	{"iOS Safari 12 - iPhone", "8b503c30b0de9991806b9f51ae743bda", "t12d2310h2_f91c41aead95_12b7a1cb7c36", akamaiSafari},
+}
+
+// TestGoldenFingerprints 测试指纹库中每个非随机指纹的分析结果，以及经客户端实际拨号发送的指纹，都与期望值一致
+func TestGoldenFingerprints(t *testing.T) {
+	server, err := fingerprint.NewEchoServer()
+	if err != nil {
+		t.Fatalf("启动回显服务器失败: %v", err)
+	}
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Addr())
+
+	golden := make(map[string]int, len(goldenFingerprints))
+	for i, g := range goldenFingerprints {
+		golden[g.name] = i
+	}
+	checked := 0
+	for _, profile := range fingerprint.NewFingerprintLibrary().GetAllProfiles() {
+		if profile.Browser == "Random" {
+			continue
+		}
+		i, ok := golden[profile.Name]
+		if !ok {
+			t.Fatalf("%s: 缺少期望指纹", profile.Name)
+		}
+		want := goldenFingerprints[i]
+		checked++
+
+		report, err := fingerprint.AnalyzeProfile(profile)
+		if err != nil {
+			t.Fatalf("%s: 分析失败: %v", profile.Name, err)
+		}
+		if report.JA3NHash != want.ja3n || report.JA4 != want.ja4 || report.Akamai != want.akamai {
+			t.Fatalf("%s: 分析结果 JA3N=%s JA4=%s Akamai=%s，期望 JA3N=%s JA4=%s Akamai=%s",
+				profile.Name, report.JA3NHash, report.JA4, report.Akamai, want.ja3n, want.ja4, want.akamai)
+		}
+
+		// 经客户端的拨号路径（指纹、ALPN 与 HTTP/2 帧改写）发送
+		c := clientLib.NewClient(&profile.HelloID, &clientLib.Config{Timeout: 5 * time.Second, InsecureSkipVerify: true})
+		resp, err := c.Get("https://localhost:"+port+"/", nil)
+		c.Close()
+		if err != nil {
+			t.Fatalf("%s: 请求失败: %v", profile.Name, err)
+		}
+		var got fingerprint.EchoReport
+		if err := json.Unmarshal(resp.Body, &got); err != nil {
+			t.Fatalf("%s: 解析回显失败: %v", profile.Name, err)
+		}
+		if got.JA3NHash != want.ja3n || got.JA4 != want.ja4 || got.Akamai != want.akamai {
+			t.Fatalf("%s: 客户端发送 JA3N=%s JA4=%s Akamai=%s，期望 JA3N=%s JA4=%s Akamai=%s",
+				profile.Name, got.JA3NHash, got.JA4, got.Akamai, want.ja3n, want.ja4, want.akamai)
+		}
+	}
+	if checked != len(goldenFingerprints) {
+		t.Fatalf("指纹库中有 %d 个非随机指纹，期望值 %d 个", checked, len(goldenFingerprints))
+	}
+}
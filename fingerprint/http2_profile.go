@@ -0,0 +1,218 @@
+package fingerprint
+
+import (
+	"strconv"
+	"strings"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+// HTTP/2 SETTINGS 参数 ID（RFC 9113 6.5.2 / RFC 9218）
+const (
+	HTTP2SettingHeaderTableSize      uint16 = 0x1
+	HTTP2SettingEnablePush           uint16 = 0x2
+	HTTP2SettingMaxConcurrentStreams uint16 = 0x3
+	HTTP2SettingInitialWindowSize    uint16 = 0x4
+	HTTP2SettingMaxFrameSize         uint16 = 0x5
+	HTTP2SettingMaxHeaderListSize    uint16 = 0x6
+	HTTP2SettingNoRFC7540Priorities  uint16 = 0x9
+)
+
+// 协议默认值（SETTINGS 中未出现的参数取默认值）
+const (
+	http2DefaultInitialWindowSize = 65535
+	http2DefaultHeaderTableSize   = 4096
+)
+
+// HTTP2Setting 一个 SETTINGS 参数
+type HTTP2Setting struct {
+	ID  uint16
+	Val uint32
+}
+
+// HTTP2Priority 流优先级（Weight 取值 1-256，与 Akamai 指纹记法一致）
+type HTTP2Priority struct {
+	StreamID  uint32 // 仅用于 PRIORITY 帧；HEADERS 帧优先级忽略该字段
+	Exclusive bool
+	StreamDep uint32
+	Weight    uint16
+}
+
+// HTTP2Profile 浏览器的 HTTP/2 连接指纹（Akamai h2 指纹的各组成部分）
+type HTTP2Profile struct {
+	// 名称
+	Name string
+
+	// 连接前言中的 SETTINGS 参数（按发送顺序）
+	Settings []HTTP2Setting
+
+	// 连接前言中 WINDOW_UPDATE（流 0）的增量，0 表示不发送
+	ConnectionFlow uint32
+
+	// 连接前言之后发送的 PRIORITY 帧（按发送顺序）
+	Priorities []HTTP2Priority
+
+	// 请求 HEADERS 帧携带的优先级（nil 表示不携带）
+	HeaderPriority *HTTP2Priority
+
+	// 伪头部顺序
+	PseudoHeaderOrder []string
+}
+
+// Setting 返回指定 SETTINGS 参数的值
+func (p *HTTP2Profile) Setting(id uint16) (uint32, bool) {
+	for _, s := range p.Settings {
+		if s.ID == id {
+			return s.Val, true
+		}
+	}
+	return 0, false
+}
+
+// InitialWindowSize 返回通告的流初始窗口大小（未设置时为协议默认值）
+func (p *HTTP2Profile) InitialWindowSize() uint32 {
+	if v, ok := p.Setting(HTTP2SettingInitialWindowSize); ok {
+		return v
+	}
+	return http2DefaultInitialWindowSize
+}
+
+// HeaderTableSize 返回通告的 HPACK 动态表大小（未设置时为协议默认值）
+func (p *HTTP2Profile) HeaderTableSize() uint32 {
+	if v, ok := p.Setting(HTTP2SettingHeaderTableSize); ok {
+		return v
+	}
+	return http2DefaultHeaderTableSize
+}
+
+// 各浏览器的 HTTP/2 指纹
+var (
+	// HTTP2Chrome117 Chrome 117+（不再发送 MAX_CONCURRENT_STREAMS）
+	HTTP2Chrome117 = &HTTP2Profile{
+		Name: "Chrome 117+",
+		Settings: []HTTP2Setting{
+			{HTTP2SettingHeaderTableSize, 65536},
+			{HTTP2SettingEnablePush, 0},
+			{HTTP2SettingInitialWindowSize, 6291456},
+			{HTTP2SettingMaxHeaderListSize, 262144},
+		},
+		ConnectionFlow:    15663105,
+		HeaderPriority:    &HTTP2Priority{Exclusive: true, StreamDep: 0, Weight: 256},
+		PseudoHeaderOrder: []string{":method", ":authority", ":scheme", ":path"},
+	}
+
+	// HTTP2Chrome106 Chrome 106-116
+	HTTP2Chrome106 = &HTTP2Profile{
+		Name: "Chrome 106-116",
+		Settings: []HTTP2Setting{
+			{HTTP2SettingHeaderTableSize, 65536},
+			{HTTP2SettingEnablePush, 0},
+			{HTTP2SettingMaxConcurrentStreams, 1000},
+			{HTTP2SettingInitialWindowSize, 6291456},
+			{HTTP2SettingMaxHeaderListSize, 262144},
+		},
+		ConnectionFlow:    15663105,
+		HeaderPriority:    &HTTP2Priority{Exclusive: true, StreamDep: 0, Weight: 256},
+		PseudoHeaderOrder: []string{":method", ":authority", ":scheme", ":path"},
+	}
+
+	// HTTP2ChromeLegacy Chrome 105 及更早版本
+	HTTP2ChromeLegacy = &HTTP2Profile{
+		Name: "Chrome Legacy",
+		Settings: []HTTP2Setting{
+			{HTTP2SettingHeaderTableSize, 65536},
+			{HTTP2SettingMaxConcurrentStreams, 1000},
+			{HTTP2SettingInitialWindowSize, 6291456},
+			{HTTP2SettingMaxHeaderListSize, 262144},
+		},
+		ConnectionFlow:    15663105,
+		HeaderPriority:    &HTTP2Priority{Exclusive: true, StreamDep: 0, Weight: 256},
+		PseudoHeaderOrder: []string{":method", ":authority", ":scheme", ":path"},
+	}
+
+	// HTTP2Firefox Firefox（连接建立后发送 PRIORITY 帧构建依赖树，请求依赖流 13）
+	HTTP2Firefox = &HTTP2Profile{
+		Name: "Firefox",
+		Settings: []HTTP2Setting{
+			{HTTP2SettingHeaderTableSize, 65536},
+			{HTTP2SettingInitialWindowSize, 131072},
+			{HTTP2SettingMaxFrameSize, 16384},
+		},
+		ConnectionFlow: 12517377,
+		Priorities: []HTTP2Priority{
+			{StreamID: 3, StreamDep: 0, Weight: 201},
+			{StreamID: 5, StreamDep: 0, Weight: 101},
+			{StreamID: 7, StreamDep: 0, Weight: 1},
+			{StreamID: 9, StreamDep: 7, Weight: 1},
+			{StreamID: 11, StreamDep: 3, Weight: 1},
+			{StreamID: 13, StreamDep: 0, Weight: 241},
+		},
+		HeaderPriority:    &HTTP2Priority{StreamDep: 13, Weight: 42},
+		PseudoHeaderOrder: []string{":method", ":path", ":authority", ":scheme"},
+	}
+
+	// HTTP2Safari Safari 16 / iOS Safari
+	HTTP2Safari = &HTTP2Profile{
+		Name: "Safari",
+		Settings: []HTTP2Setting{
+			{HTTP2SettingInitialWindowSize, 4194304},
+			{HTTP2SettingMaxConcurrentStreams, 100},
+		},
+		ConnectionFlow:    10485760,
+		HeaderPriority:    &HTTP2Priority{StreamDep: 0, Weight: 255},
+		PseudoHeaderOrder: []string{":method", ":scheme", ":path", ":authority"},
+	}
+
+	// HTTP2OkHttp Android OkHttp
+	HTTP2OkHttp = &HTTP2Profile{
+		Name: "OkHttp",
+		Settings: []HTTP2Setting{
+			{HTTP2SettingInitialWindowSize, 16777216},
+		},
+		ConnectionFlow:    16711681,
+		PseudoHeaderOrder: []string{":method", ":path", ":authority", ":scheme"},
+	}
+)
+
+// HTTP2ProfileFor 根据 uTLS 指纹返回对应浏览器的 HTTP/2 指纹
+// 已注册的自定义指纹优先使用其自带的 HTTP/2 指纹；
+// Golang 指纹返回 nil（保持 Go 原生行为）；随机及自定义指纹按最新 Chrome 处理
+func HTTP2ProfileFor(helloID utls.ClientHelloID) *HTTP2Profile {
+	if profile, ok := LookupProfile(helloID); ok && profile.HTTP2 != nil {
+		return profile.HTTP2
+	}
+
+	switch helloID.Client {
+	case "Golang":
+		return nil
+	case "Firefox":
+		return HTTP2Firefox
+	case "Safari", "iOS":
+		return HTTP2Safari
+	case "Android":
+		return HTTP2OkHttp
+	case "Chrome", "Edge":
+		return chromeHTTP2Profile(helloID.Version)
+	case "360Browser", "QQBrowser":
+		return HTTP2ChromeLegacy
+	default:
+		return HTTP2Chrome117
+	}
+}
+
+// chromeHTTP2Profile 按 Chromium 主版本号选择 HTTP/2 指纹（版本如 "112_PSK"）
+func chromeHTTP2Profile(version string) *HTTP2Profile {
+	end := strings.IndexFunc(version, func(r rune) bool { return r < '0' || r > '9' })
+	if end >= 0 {
+		version = version[:end]
+	}
+	major, err := strconv.Atoi(version)
+	switch {
+	case err != nil || major >= 117:
+		return HTTP2Chrome117
+	case major >= 106:
+		return HTTP2Chrome106
+	default:
+		return HTTP2ChromeLegacy
+	}
+}
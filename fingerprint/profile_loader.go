@@ -0,0 +1,218 @@
+package fingerprint
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	utls "github.com/refraction-networking/utls"
+	"gopkg.in/yaml.v3"
+)
+
+// profileFileDef 指纹定义文件格式（JSON/YAML）
+//
+//	profiles:
+//	  - name: "Chrome 140 - Windows"
+//	    browser: Chrome
+//	    version: "140"
+//	    user_agent: "Mozilla/5.0 ..."
+//	    http2: chrome
+//	    spec:
+//	      cipher_suites: [GREASE, TLS_AES_128_GCM_SHA256, ...]
+//	      extensions:
+//	        - name: server_name
+//	        - name: supported_groups
+//	          groups: [GREASE, X25519MLKEM768, x25519, secp256r1, secp384r1]
+type profileFileDef struct {
+	Profiles []profileDef `json:"profiles"`
+}
+
+// profileDef 单个指纹定义
+type profileDef struct {
+	Name        string `json:"name"`
+	UserAgent   string `json:"user_agent"`
+	Description string `json:"description"`
+	Platform    string `json:"platform"`
+	Browser     string `json:"browser"`
+	Version     string `json:"version"`
+
+	// HelloID.Client（可选，默认取 Browser）
+	Client string `json:"client,omitempty"`
+
+	// 内置 HTTP/2 指纹名称（可选，默认按 Client 与 Version 选择）
+	HTTP2 string `json:"http2,omitempty"`
+
+	Spec *ClientHelloSpecDef `json:"spec"`
+}
+
+// http2ProfilesByName 定义文件中可引用的内置 HTTP/2 指纹
+var http2ProfilesByName = map[string]*HTTP2Profile{
+	"chrome":        HTTP2Chrome117,
+	"chrome106":     HTTP2Chrome106,
+	"chrome_legacy": HTTP2ChromeLegacy,
+	"firefox":       HTTP2Firefox,
+	"safari":        HTTP2Safari,
+	"okhttp":        HTTP2OkHttp,
+}
+
+// 已注册的自定义指纹（键为 HelloID 的 Client-Version）
+var (
+	customProfilesMu sync.RWMutex
+	customProfiles   = make(map[string]*FingerprintProfile)
+)
+
+// customProfileKey 生成自定义指纹注册键
+func customProfileKey(helloID utls.ClientHelloID) string {
+	return helloID.Client + "-" + helloID.Version
+}
+
+// RegisterProfile 注册携带 ClientHelloSpec 的自定义指纹
+// 注册后使用该 HelloID 的客户端按 Spec 构造 ClientHello（HelloCustom + ApplyPreset），
+// 与 utls 内置指纹同名时覆盖内置指纹
+func RegisterProfile(profile FingerprintProfile) error {
+	if profile.Spec == nil {
+		return fmt.Errorf("指纹 %s 缺少 ClientHelloSpec", profile.Name)
+	}
+	if profile.HelloID.Client == "" {
+		return fmt.Errorf("指纹 %s 缺少 HelloID", profile.Name)
+	}
+	if err := profile.Spec.Validate(); err != nil {
+		return fmt.Errorf("指纹 %s 的 ClientHelloSpec 无效: %w", profile.Name, err)
+	}
+
+	customProfilesMu.Lock()
+	defer customProfilesMu.Unlock()
+	customProfiles[customProfileKey(profile.HelloID)] = &profile
+	return nil
+}
+
+// LookupProfile 查找已注册的自定义指纹
+func LookupProfile(helloID utls.ClientHelloID) (*FingerprintProfile, bool) {
+	customProfilesMu.RLock()
+	defer customProfilesMu.RUnlock()
+	profile, ok := customProfiles[customProfileKey(helloID)]
+	return profile, ok
+}
+
+// LoadProfiles 从 JSON/YAML 文件加载指纹定义（按扩展名 .json/.yaml/.yml 判断格式）并校验
+func LoadProfiles(path string) ([]FingerprintProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取指纹文件失败: %w", err)
+	}
+
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	profiles, err := ParseProfiles(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("解析指纹文件 %s 失败: %w", path, err)
+	}
+	return profiles, nil
+}
+
+// ParseProfiles 解析指纹定义（format 为 "json"、"yaml" 或 "yml"）并校验
+func ParseProfiles(data []byte, format string) ([]FingerprintProfile, error) {
+	switch format {
+	case "json":
+	case "yaml", "yml":
+		// YAML 先转为 JSON，复用同一套字段标签与校验
+		var doc interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("YAML 格式错误: %w", err)
+		}
+		var err error
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("YAML 转换失败: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("不支持的格式: %s", format)
+	}
+
+	var file profileFileDef
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("JSON 格式错误: %w", err)
+	}
+	if len(file.Profiles) == 0 {
+		return nil, fmt.Errorf("未定义任何指纹")
+	}
+
+	profiles := make([]FingerprintProfile, 0, len(file.Profiles))
+	for i, def := range file.Profiles {
+		profile, err := def.toProfile()
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 个指纹: %w", i+1, err)
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles, nil
+}
+
+// toProfile 校验定义并转换为指纹配置
+func (d *profileDef) toProfile() (FingerprintProfile, error) {
+	if d.Name == "" {
+		return FingerprintProfile{}, fmt.Errorf("name 不能为空")
+	}
+	if d.Spec == nil {
+		return FingerprintProfile{}, fmt.Errorf("%s: spec 不能为空", d.Name)
+	}
+	if err := d.Spec.Validate(); err != nil {
+		return FingerprintProfile{}, fmt.Errorf("%s: %w", d.Name, err)
+	}
+
+	client := d.Client
+	if client == "" {
+		client = d.Browser
+	}
+	if client == "" {
+		client = utls.HelloCustom.Client
+	}
+	helloID := utls.ClientHelloID{Client: client, Version: d.Version}
+
+	h2 := HTTP2ProfileFor(helloID)
+	if d.HTTP2 != "" {
+		var ok bool
+		if h2, ok = http2ProfilesByName[strings.ToLower(d.HTTP2)]; !ok {
+			return FingerprintProfile{}, fmt.Errorf("%s: 未知的 HTTP/2 指纹 %s", d.Name, d.HTTP2)
+		}
+	}
+
+	return FingerprintProfile{
+		Name:        d.Name,
+		HelloID:     helloID,
+		UserAgent:   d.UserAgent,
+		Description: d.Description,
+		Platform:    d.Platform,
+		Browser:     d.Browser,
+		Version:     d.Version,
+		HTTP2:       h2,
+		Spec:        d.Spec,
+	}, nil
+}
+
+// LoadProfilesFromFile 从文件加载自定义指纹，注册后加入指纹库（同名指纹被替换）
+func (lib *FingerprintLibrary) LoadProfilesFromFile(path string) (int, error) {
+	profiles, err := LoadProfiles(path)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, profile := range profiles {
+		if err := RegisterProfile(profile); err != nil {
+			return 0, err
+		}
+		replaced := false
+		for i := range lib.profiles {
+			if lib.profiles[i].Name == profile.Name {
+				lib.profiles[i] = profile
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			lib.profiles = append(lib.profiles, profile)
+		}
+	}
+	return len(profiles), nil
+}
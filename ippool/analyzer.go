@@ -2,6 +2,7 @@ package ippool
 
 import (
 	"fmt"
+	"math/rand/v2"
 )
 
 // Analyzer IP 池分析器
@@ -315,12 +316,18 @@ func (a *Analyzer) GetRandomIP(host string) (string, error) {
 		return "", fmt.Errorf("主机 %s 没有可用的 IP", host)
 	}
 
-	// 优先返回 IPv4
-	if len(pool.IPv4) > 0 {
-		return pool.IPv4[0], nil // 简化实现，实际可以使用随机选择
+	// 优先返回 IPv4，排除黑名单中的 IP；全部被拉黑时仍从完整列表中选择
+	ips := a.library.FilterIPs(host, pool.IPv4)
+	if len(ips) == 0 {
+		ips = a.library.FilterIPs(host, pool.IPv6)
 	}
-
-	return pool.IPv6[0], nil
+	if len(ips) == 0 {
+		ips = pool.IPv4
+	}
+	if len(ips) == 0 {
+		ips = pool.IPv6
+	}
+	return ips[rand.IntN(len(ips))], nil
 }
 
 // GetAllIPsByHost 获取指定主机的所有 IP（简化格式）
@@ -545,29 +545,13 @@ func (lib *IPPoolLibrary) shouldUpdateDetailPool(host string) bool {
 	}
 
 	// 本地数据较旧，检查服务器是否有更新
-	// 使用带超时的上下文，避免长时间阻塞
+	// 使用带超时的上下文，避免长时间阻塞（超时后上游请求会被直接中止）
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	// 注意：这个方法需要下载完整 JSON，如果网络慢会比较慢
 	// 但通过超时控制，避免单个请求阻塞太久
-	done := make(chan bool, 1)
-	var serverLastUpdated time.Time
-	var err error
-
-	go func() {
-		serverLastUpdated, err = lib.getServerLastUpdated(host)
-		done <- true
-	}()
-
-	select {
-	case <-done:
-		// 完成检查
-	case <-ctx.Done():
-		// 超时，使用本地数据，不更新
-		return false
-	}
-
+	serverLastUpdated, err := lib.getServerLastUpdated(ctx, host)
 	if err != nil {
 		// 如果获取失败（网络不通或超时），使用本地数据，不更新
 		return false
@@ -585,7 +569,7 @@ func (lib *IPPoolLibrary) shouldUpdateDetailPool(host string) bool {
 // getServerLastUpdated 获取服务器上指定主机的 last_updated 时间
 // 这个方法只读取 JSON 的 stats 部分来判断，避免下载完整数据
 // 注意：这个方法会发起网络请求，如果网络慢可能会阻塞
-func (lib *IPPoolLibrary) getServerLastUpdated(host string) (time.Time, error) {
+func (lib *IPPoolLibrary) getServerLastUpdated(ctx context.Context, host string) (time.Time, error) {
 	// 如果处于离线模式，从本地文件读取
 	if lib.IsOfflineMode() {
 		lib.detailPoolsMu.RLock()
@@ -609,7 +593,7 @@ func (lib *IPPoolLibrary) getServerLastUpdated(host string) (time.Time, error) {
 	url := fmt.Sprintf("%s%s", lib.baseURL, hostInfo.DetailURL)
 
 	// 使用带超时的请求（缩短超时时间，快速失败）
-	resp, err := lib.client.Get(url, map[string]string{
+	resp, err := lib.client.GetContext(ctx, url, map[string]string{
 		"Accept": "application/json",
 	})
 	if err != nil {
@@ -737,6 +721,14 @@ func (lib *IPPoolLibrary) ReportStatus(host, ip string, statusCode int) {
 	}
 }
 
+// ReportError 根据请求错误的类别更新黑名单：TLS 握手被对端重置、关闭或收到对端告警（多为针对该 IP 的封锁）-> 加入黑名单；
+// 本端的证书校验失败（如证书过期、公钥固定不匹配）、超时（多为路由问题）、域名解析与代理错误（与该 IP 无关）不影响名单
+func (lib *IPPoolLibrary) ReportError(host, ip string, err error) {
+	if clientLib.HandshakeRejected(err) {
+		lib.ReportStatus(host, ip, 403)
+	}
+}
+
 // FilterIPs 过滤掉黑名单中的 IP（保留顺序）
 func (lib *IPPoolLibrary) FilterIPs(host string, ips []string) []string {
 	lib.banMu.RLock()
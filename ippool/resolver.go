@@ -0,0 +1,45 @@
+package ippool
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+
+	clientLib "utls_client/lib"
+)
+
+// Resolver 基于 IP 池的域名解析器，实现 clientLib.Resolver
+// 将池中主机（如 kh.google.com）解析为未被拉黑的池内 IP，配合 clientLib.Config.Resolver 使用时 SNI 与 Host 保持原域名；
+// 同时设置 clientLib.DialHappyEyeballs 时池中的 IPv6/IPv4 地址交替竞速
+type Resolver struct {
+	library  *IPPoolLibrary
+	fallback clientLib.Resolver
+}
+
+// NewResolver 创建 IP 池解析器
+// fallback 用于解析池中没有的主机（为 nil 时这类主机返回错误）
+func NewResolver(library *IPPoolLibrary, fallback clientLib.Resolver) *Resolver {
+	return &Resolver{library: library, fallback: fallback}
+}
+
+// LookupHost 返回主机允许使用的池内 IP（IPv4 在前，同族内随机排列以分散负载）
+func (r *Resolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	pool, err := r.library.GetIPPool(host)
+	if err != nil {
+		if r.fallback != nil {
+			return r.fallback.LookupHost(ctx, host)
+		}
+		return nil, err
+	}
+
+	ipv4 := r.library.FilterIPs(host, append([]string(nil), pool.IPv4...))
+	ipv6 := r.library.FilterIPs(host, append([]string(nil), pool.IPv6...))
+	rand.Shuffle(len(ipv4), func(i, j int) { ipv4[i], ipv4[j] = ipv4[j], ipv4[i] })
+	rand.Shuffle(len(ipv6), func(i, j int) { ipv6[i], ipv6[j] = ipv6[j], ipv6[i] })
+
+	ips := append(ipv4, ipv6...)
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("主机 %s 没有可用的 IP", host)
+	}
+	return ips, nil
+}
@@ -1,82 +1,816 @@
 package utls_client
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math/rand/v2"
 	"net"
 	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	utls "github.com/refraction-networking/utls"
+	"golang.org/x/net/http2"
 )
 
-// ConnPoolManager 针对远端IPv6地址的长连接预热与复用
+const (
+	// poolPort 远端 IP 未带端口时使用的端口
+	poolPort = "443"
+	// defaultPoolPingInterval 默认 PING 保活间隔
+	defaultPoolPingInterval = 30 * time.Second
+	// poolPingTimeout 单次 PING 的超时时间
+	poolPingTimeout = 10 * time.Second
+	// defaultMaxConnsPerIP 默认每个远端 IP 的最大连接数
+	defaultMaxConnsPerIP = 4
+	// defaultWarmUpConcurrency 默认预热时同时进行的拨号数
+	defaultWarmUpConcurrency = 64
+	// poolIdleConnTimeout 额外连接（每个 IP 的第一条之外）空闲超过该时长后关闭
+	poolIdleConnTimeout = 5 * time.Minute
+	// poolGoAwayHistory 每个远端 IP 保留的 GOAWAY 记录数
+	poolGoAwayHistory = 32
+	// poolShutdownTimeout 轮换的旧连接等待进行中的流结束的最长时间
+	poolShutdownTimeout = time.Minute
+)
+
+// ConnPoolManager 针对远端 IP 的 HTTP/2 长连接池
+// 每个远端 IP 维护以配置的 SNI（Config.ServerName）握手的 HTTP/2 连接，按配置的指纹改写 TLS 与 HTTP/2 帧；
+// 请求只发往并发流未达服务端 SETTINGS_MAX_CONCURRENT_STREAMS 的连接，全部饱和时新建连接（不超过每 IP 上限，
+// 达到上限后在最空闲的连接上排队）；连接定期 PING 保活，断开后自动重建，请求经 Do 直接在该 IP 的连接上发送；
+// 设置最大存活时长后连接到期前换用新连接，Drain / Close 结束连接池
 type ConnPoolManager struct {
 	mu       sync.RWMutex
-	clients  map[string]*Client   // remoteIP -> client
-	lastOK   map[string]time.Time // 最近成功时间
+	conns    map[string]*poolConn // remoteIP（可带端口）-> 连接组
+	health   *poolHealth
 	helloID  utls.ClientHelloID
 	baseConf *Config
+
+	// 拨号、请求头与响应处理复用 Client 的实现
+	client    *Client
+	transport *http2.Transport
+	h2opts    h2ConnOptions
+
+	pingInterval  time.Duration
+	maxConnsPerIP int
+	warmUpLimit   int
+	maxConnAge    time.Duration
+	connAgeJitter time.Duration
+	selector      Selector
+
+	life *lifecycle
+}
+
+// poolConn 一个远端 IP 的连接组（mu 保护连接选择，拨号期间不持有）
+type poolConn struct {
+	key  string // 调用方传入的 remoteIP
+	ip   string
+	addr string // ip:port
+
+	mu      sync.Mutex
+	conns   []*poolH2Conn // 按建立时间排序
+	dialing bool          // 是否有拨号进行中（同一 IP 同时只拨一条）
+	dialed  chan struct{} // 拨号结束时关闭，没有连接的请求借此等待
+
+	// GOAWAY 记录由连接的读协程写入，单独加锁，不与连接选择竞争
+	gmu     sync.Mutex
+	goAways []GoAwayRecord
+}
+
+// poolH2Conn 连接组中的一条 HTTP/2 连接
+type poolH2Conn struct {
+	cc       *http2.ClientConn
+	created  time.Time
+	requests atomic.Uint64
+}
+
+// PoolConnStats 连接池中一条 HTTP/2 连接的状态
+type PoolConnStats struct {
+	// 远端 IP（与 Do 传入的一致，可带端口）
+	RemoteIP string
+
+	// 建立时间与已建立的时长
+	Created time.Time
+	Age     time.Duration
+
+	// 进行中的流数（含已预留尚未发送的）与超出并发上限排队等待的请求数
+	ActiveStreams  int
+	PendingStreams int
+
+	// 服务端 SETTINGS 通告的最大并发流数
+	MaxConcurrentStreams uint32
+
+	// 该连接上已发送的请求数
+	Requests uint64
+
+	// 是否正在关闭（如已收到 GOAWAY），不再接收新请求
+	Closing bool
+
+	// 最近一次变为空闲的时间（从未空闲时为零值）
+	LastIdle time.Time
+}
+
+// GoAwayRecord 连接收到的一次 GOAWAY
+type GoAwayRecord struct {
+	// 远端 IP（与 Do 传入的一致，可带端口）
+	RemoteIP string
+
+	// 收到的时间，以及此时连接已建立的时长与已发送的请求数
+	Time     time.Time
+	ConnAge  time.Duration
+	Requests uint64
+
+	// 服务端处理过的最大流 ID、错误码与调试数据
+	LastStreamID uint32
+	ErrCode      http2.ErrCode
+	DebugData    string
 }
 
 func NewConnPoolManager(hello utls.ClientHelloID, base *Config) *ConnPoolManager {
 	if base == nil {
 		base = &Config{Timeout: 30 * time.Second}
 	}
+	client := NewClient(&hello, base)
+	profile := client.http2Profile(&hello)
+	// 严格遵守服务端的并发流上限：饱和的连接上请求排队等待，是否新建连接由连接池判断
+	transport := newHTTP2Transport(profile, false)
+	transport.StrictMaxConcurrentStreams = true
 	return &ConnPoolManager{
-		clients:  make(map[string]*Client),
-		lastOK:   make(map[string]time.Time),
-		helloID:  hello,
-		baseConf: base,
+		conns:         make(map[string]*poolConn),
+		health:        newPoolHealth(),
+		helloID:       hello,
+		baseConf:      base,
+		client:        client,
+		transport:     transport,
+		h2opts:        h2ConnOptions{pseudoOrder: client.pseudoHeaderOrder(&hello), profile: profile},
+		pingInterval:  defaultPoolPingInterval,
+		maxConnsPerIP: defaultMaxConnsPerIP,
+		warmUpLimit:   defaultWarmUpConcurrency,
+		selector:      NewRoundRobinSelector(),
+		life:          newLifecycle(nil),
+	}
+}
+
+// SetMaxConnsPerIP 设置每个远端 IP 的最大连接数（所有连接的并发流都达到服务端上限时才新建连接）
+func (m *ConnPoolManager) SetMaxConnsPerIP(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if n > 0 {
+		m.maxConnsPerIP = n
+	}
+}
+
+// SetWarmUpConcurrency 设置预热时同时进行的拨号数（默认 64）
+func (m *ConnPoolManager) SetWarmUpConcurrency(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if n > 0 {
+		m.warmUpLimit = n
+	}
+}
+
+// SetPingInterval 设置 PING 保活间隔（只影响之后建立的连接）
+func (m *ConnPoolManager) SetPingInterval(interval time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if interval > 0 {
+		m.pingInterval = interval
+	}
+}
+
+// SetMaxConnAge 设置连接的最大存活时长（只影响之后建立的连接，0 表示不限）
+// 每条连接的存活时长为 age 减去 [0, jitter) 内的随机值，使同时建立的连接错开轮换；
+// 到期时一个 IP 仅剩的连接先建立替换连接再退出，旧连接不再接收新请求，进行中的流结束后关闭
+func (m *ConnPoolManager) SetMaxConnAge(age, jitter time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maxConnAge, m.connAgeJitter = max(age, 0), max(min(jitter, age), 0)
+}
+
+// SetSelector 设置 Do 只给出主机名时选择远端 IP 的策略（nil 恢复默认的轮询）
+func (m *ConnPoolManager) SetSelector(s Selector) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s == nil {
+		s = NewRoundRobinSelector()
 	}
+	m.selector = s
+}
+
+// WarmUp 针对一组远端 IP 建立 HTTP/2 连接（TLS 握手并确认 PING 可达），返回各 IP 的失败原因
+func (m *ConnPoolManager) WarmUp(remoteIPs []string) error {
+	return m.WarmUpContext(context.Background(), remoteIPs)
 }
 
-// WarmUp 针对一组远端IPv6预热HTTP/2连接（SNI/Host 请由请求时设置）
-func (m *ConnPoolManager) WarmUp(remoteIPs []string) {
+// WarmUpContext 针对一组远端 IP 建立 HTTP/2 连接（支持取消与截止时间）
+// 已有可用连接的 IP 不重复拨号，隔离中的 IP 不拨号；同时进行的拨号数受 SetWarmUpConcurrency 限制
+func (m *ConnPoolManager) WarmUpContext(ctx context.Context, remoteIPs []string) error {
+	m.mu.RLock()
+	sem := make(chan struct{}, m.warmUpLimit)
+	m.mu.RUnlock()
+
 	var wg sync.WaitGroup
-	for _, ip := range remoteIPs {
-		ip := ip
+	errs := make([]error, len(remoteIPs))
+	for i, ip := range remoteIPs {
+		if m.health.state(ip) != IPHealthy {
+			errs[i] = fmt.Errorf("预热 %s 失败: %w", ip, ErrIPQuarantined)
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			errs[i] = fmt.Errorf("预热 %s 失败: %w", ip, ctx.Err())
+			continue
+		}
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			// 构建客户端（可选绑定本地源IP：通过 m.baseConf.LocalIP）
-			cli := NewClient(&m.helloID, m.baseConf)
-			// 进行一次轻量请求，促进建立HTTP/2会话（由上层传入时再真正请求）
-			// 这里不立即发网络请求，交由上层第一次 Do 时建立；仅缓存 client
-			m.mu.Lock()
-			m.clients[ip] = cli
-			m.mu.Unlock()
+			defer func() { <-sem }()
+			if _, err := m.conn(ctx, ip, false); err != nil {
+				errs[i] = fmt.Errorf("预热 %s 失败: %w", ip, err)
+			}
 		}()
 	}
 	wg.Wait()
+	return errors.Join(errs...)
 }
 
-func (m *ConnPoolManager) Get(remoteIP string) (*Client, bool) {
+// Warm 判断远端 IP 是否有可用的连接
+func (m *ConnPoolManager) Warm(remoteIP string) bool {
 	m.mu.RLock()
-	defer m.mu.RUnlock()
-	c, ok := m.clients[remoteIP]
-	return c, ok
+	pc, ok := m.conns[remoteIP]
+	m.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return slices.ContainsFunc(pc.conns, func(c *poolH2Conn) bool { return usable(c.cc) })
 }
 
-// MarkResult 记录结果，便于上层实现黑/白名单等策略
-func (m *ConnPoolManager) MarkResult(remoteIP string, status int, err error) {
+// ConnStats 返回连接池中所有连接的状态（按远端 IP 与建立时间排序）
+func (m *ConnPoolManager) ConnStats() []PoolConnStats {
+	now := time.Now()
+	var stats []PoolConnStats
+	for _, pc := range m.slots() {
+		pc.mu.Lock()
+		for _, c := range pc.conns {
+			state := c.cc.State()
+			stats = append(stats, PoolConnStats{
+				RemoteIP:             pc.key,
+				Created:              c.created,
+				Age:                  now.Sub(c.created),
+				ActiveStreams:        state.StreamsActive + state.StreamsReserved,
+				PendingStreams:       state.StreamsPending,
+				MaxConcurrentStreams: state.MaxConcurrentStreams,
+				Requests:             c.requests.Load(),
+				Closing:              state.Closing || state.Closed,
+				LastIdle:             state.LastIdle,
+			})
+		}
+		pc.mu.Unlock()
+	}
+	return stats
+}
+
+// GoAways 返回远端 IP 最近收到的 GOAWAY（按时间先后，每个 IP 保留最近 32 条）；remoteIP 为空时返回所有 IP 的记录
+func (m *ConnPoolManager) GoAways(remoteIP string) []GoAwayRecord {
+	var records []GoAwayRecord
+	for _, pc := range m.slots() {
+		if remoteIP != "" && pc.key != remoteIP {
+			continue
+		}
+		pc.gmu.Lock()
+		records = append(records, pc.goAways...)
+		pc.gmu.Unlock()
+	}
+	return records
+}
+
+// slots 返回按远端 IP 排序的连接组
+func (m *ConnPoolManager) slots() []*poolConn {
+	m.mu.RLock()
+	slots := make([]*poolConn, 0, len(m.conns))
+	for _, pc := range m.conns {
+		slots = append(slots, pc)
+	}
+	m.mu.RUnlock()
+	slices.SortFunc(slots, func(a, b *poolConn) int { return strings.Compare(a.key, b.key) })
+	return slots
+}
+
+// Do 在远端 IP 的连接上发送请求（没有可用连接时先建立）
+// remoteIP 可带端口（如 [2a00::1]:8443），未带时为 443；请求 URL 为 https://<remoteIP><req.Path>，:authority 取 req.Host，未设置时为 Config.ServerName；
+// remoteIP 也可以是主机名（可带端口）：解析出的 IP 中排除隔离中的 IP 后由 Selector 选择，:authority 未设置时为该主机名；
+// 连接收到 GOAWAY 或拒绝该流时在新连接上重试一次（仅限没有请求体的请求）；
+// 结果计入该 IP 的健康状态，隔离中的 IP 直接返回 ErrIPQuarantined；连接池关闭或排空后返回 ErrClosed
+func (m *ConnPoolManager) Do(ctx context.Context, remoteIP string, req *RequestConfig) (*Response, error) {
+	if req == nil {
+		req = &RequestConfig{}
+	}
+	if err := m.life.begin(); err != nil {
+		return nil, err
+	}
+	defer m.life.end()
+	_, addr, err := splitPoolAddr(remoteIP)
+	if err != nil {
+		var host string
+		if remoteIP, host, err = m.selectIP(ctx, remoteIP, req); err != nil {
+			return nil, err
+		}
+		if req.Host == "" {
+			hostReq := *req
+			hostReq.Host = host
+			req = &hostReq
+		}
+		_, addr, _ = splitPoolAddr(remoteIP)
+	}
+	probe, err := m.health.admit(remoteIP, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer m.health.release(remoteIP)
+	start := time.Now()
+	response, err := m.do(ctx, addr, remoteIP, req)
+	status := 0
+	if response != nil {
+		status = response.StatusCode
+	}
+	outcome := err
+	if ctx.Err() != nil {
+		// 调用方取消或超时不反映该 IP 的健康状况
+		outcome = context.Canceled
+	}
+	if m.health.record(remoteIP, probe, status, outcome, time.Since(start), time.Now()) {
+		m.evict(remoteIP)
+	}
+	return response, err
+}
+
+// selectIP 解析主机名（可带端口），由 Selector 在未隔离的 IP 中选择一个，返回该 IP（带端口时为 ip:port）与主机名
+func (m *ConnPoolManager) selectIP(ctx context.Context, target string, req *RequestConfig) (remoteIP, host string, err error) {
+	host, port := target, ""
+	if h, p, err := net.SplitHostPort(target); err == nil {
+		host, port = h, p
+	}
+	if host == "" {
+		return "", "", fmt.Errorf("无效的远端地址: %s", target)
+	}
+
+	m.mu.RLock()
+	localIP, selector := m.baseConf.LocalIP, m.selector
+	m.mu.RUnlock()
+	ips, err := m.client.lookupHost(ctx, host, localIP)
+	if err != nil {
+		return "", "", err
+	}
+	keys := make([]string, len(ips))
+	for i, ip := range ips {
+		keys[i] = ip
+		if port != "" {
+			keys[i] = net.JoinHostPort(ip, port)
+		}
+	}
+
+	candidates := m.health.candidates(keys, time.Now())
+	if len(candidates) == 0 {
+		return "", "", fmt.Errorf("%s 没有可用的 IP: %w", host, ErrIPQuarantined)
+	}
+	key := req.ShardKey
+	if key == "" {
+		key = req.Path
+	}
+	i := selector.Select(key, candidates)
+	if i < 0 || i >= len(candidates) {
+		return "", "", fmt.Errorf("选择器返回了无效的下标 %d（候选 %d 个）", i, len(candidates))
+	}
+	return candidates[i].IP, host, nil
+}
+
+// do 发送请求并读取响应
+func (m *ConnPoolManager) do(ctx context.Context, addr, remoteIP string, req *RequestConfig) (*Response, error) {
+	if timeout := m.baseConf.Timeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	httpReq, err := m.newRequest(ctx, addr, req)
+	if err != nil {
+		return nil, err
+	}
+	result := &roundTripResult{attempts: 1}
+	resp, err := m.roundTrip(ctx, remoteIP, httpReq)
+	if err != nil && req.Body == nil && ctx.Err() == nil && classifyError(err) == RetryOnGoAway {
+		result.attempts++
+		resp, err = m.roundTrip(ctx, remoteIP, httpReq)
+	}
+	if err != nil {
+		return nil, stageError(requestStage(err), addr, err)
+	}
+
+	result.resp = resp
+	if ap, err := netip.ParseAddrPort(addr); err == nil {
+		result.remote = net.TCPAddrFromAddrPort(ap)
+	}
+	return m.client.newResponse(result, req)
+}
+
+// newRequest 构建发往远端地址的请求
+func (m *ConnPoolManager) newRequest(ctx context.Context, addr string, req *RequestConfig) (*http.Request, error) {
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	target := "https://" + strings.TrimSuffix(addr, ":"+poolPort) + req.Path
+	httpReq, err := http.NewRequestWithContext(ctx, method, target, req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+
+	httpReq.Host = req.Host
+	if httpReq.Host == "" {
+		httpReq.Host = m.baseConf.ServerName
+	}
+	applyRequestHeaders(httpReq, req)
+	if m.baseConf.AutoDecompress && !hasHeader(httpReq.Header, "Accept-Encoding") {
+		httpReq.Header.Set("Accept-Encoding", defaultAcceptEncoding)
+	}
+	return httpReq, nil
+}
+
+// roundTrip 取得远端 IP 的连接并发送请求
+func (m *ConnPoolManager) roundTrip(ctx context.Context, remoteIP string, httpReq *http.Request) (*http.Response, error) {
+	c, err := m.conn(ctx, remoteIP, true)
+	if err != nil {
+		return nil, err
+	}
+	c.requests.Add(1)
+	return c.cc.RoundTrip(httpReq)
+}
+
+// conn 返回远端 IP 的可用连接，没有时建立新连接
+// reserve 为 true 时为请求预留一个并发流：依次选择并发流未达上限的连接，全部饱和时新建连接，
+// 连接数达到上限后返回排队请求最少的连接；同一 IP 同时只拨一条连接，其余需要新连接的请求等待拨号结束
+// （拨号期间不持有 pc.mu，可用已有连接的请求不受影响）
+func (m *ConnPoolManager) conn(ctx context.Context, remoteIP string, reserve bool) (*poolH2Conn, error) {
+	ip, addr, err := splitPoolAddr(remoteIP)
+	if err != nil {
+		return nil, err
+	}
 	m.mu.Lock()
-	defer m.mu.Unlock()
-	if err == nil && status == http.StatusOK {
-		m.lastOK[remoteIP] = time.Now()
+	pc, ok := m.conns[remoteIP]
+	if !ok {
+		pc = &poolConn{key: remoteIP, ip: ip, addr: addr}
+		m.conns[remoteIP] = pc
+	}
+	maxConns := m.maxConnsPerIP
+	m.mu.Unlock()
+
+	for {
+		pc.mu.Lock()
+		pc.prune()
+		// 关闭或排空后不再建立新连接，排空期间进行中的请求仍可使用已有连接
+		closed := m.life.isClosed()
+		if closed && (!reserve || len(pc.conns) == 0) {
+			pc.mu.Unlock()
+			return nil, ErrClosed
+		}
+		for _, c := range pc.conns {
+			if !reserve || (freeStreams(c.cc) && c.cc.ReserveNewRequest()) {
+				pc.mu.Unlock()
+				return c, nil
+			}
+		}
+		if !closed && !pc.dialing && len(pc.conns) < maxConns {
+			pc.dialing = true
+			pc.mu.Unlock()
+			return m.dialConn(ctx, pc, reserve)
+		}
+		if closed || len(pc.conns) >= maxConns {
+			c := slices.MinFunc(pc.conns, func(a, b *poolH2Conn) int {
+				return queued(a.cc) - queued(b.cc)
+			})
+			pc.mu.Unlock()
+			return c, nil
+		}
+
+		// 拨号进行中：等待拨号结束后重新选择
+		if pc.dialed == nil {
+			pc.dialed = make(chan struct{})
+		}
+		dialed := pc.dialed
+		pc.mu.Unlock()
+		select {
+		case <-dialed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// dialConn 在不持有 pc.mu 的情况下拨号（调用方已将 pc.dialing 置为 true），成功后加入连接组
+func (m *ConnPoolManager) dialConn(ctx context.Context, pc *poolConn, reserve bool) (*poolH2Conn, error) {
+	c, err := m.dial(ctx, pc)
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.dialing = false
+	if pc.dialed != nil {
+		close(pc.dialed)
+		pc.dialed = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if m.life.isClosed() {
+		c.cc.Close()
+		return nil, ErrClosed
+	}
+	if reserve {
+		c.cc.ReserveNewRequest()
+	}
+	pc.conns = append(pc.conns, c)
+	go m.keepAlive(pc, c)
+	return c, nil
+}
+
+// prune 关闭并移除不再可用的连接（调用方持有 pc.mu）
+func (pc *poolConn) prune() {
+	pc.conns = slices.DeleteFunc(pc.conns, func(c *poolH2Conn) bool {
+		if usable(c.cc) {
+			return false
+		}
+		c.cc.Close()
+		return true
+	})
+}
+
+// remove 从连接组移除连接，返回连接是否仍在组内以及移除后剩余的连接数
+func (pc *poolConn) remove(c *poolH2Conn) (found bool, remaining int) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	n := len(pc.conns)
+	pc.conns = slices.DeleteFunc(pc.conns, func(x *poolH2Conn) bool { return x == c })
+	return len(pc.conns) < n, len(pc.conns)
+}
+
+// recordGoAway 记录连接收到的 GOAWAY（只保留最近 poolGoAwayHistory 条）
+func (pc *poolConn) recordGoAway(c *poolH2Conn, lastStreamID uint32, code http2.ErrCode, debugData []byte) {
+	now := time.Now()
+	pc.gmu.Lock()
+	defer pc.gmu.Unlock()
+	pc.goAways = append(pc.goAways, GoAwayRecord{
+		RemoteIP:     pc.key,
+		Time:         now,
+		ConnAge:      now.Sub(c.created),
+		Requests:     c.requests.Load(),
+		LastStreamID: lastStreamID,
+		ErrCode:      code,
+		DebugData:    string(debugData),
+	})
+	if over := len(pc.goAways) - poolGoAwayHistory; over > 0 {
+		pc.goAways = slices.Delete(pc.goAways, 0, over)
+	}
+}
+
+// dial 以配置的 SNI 与指纹连接远端 IP，建立 HTTP/2 会话并以 PING 确认服务端可达（PING 应答时已收到服务端 SETTINGS）
+func (m *ConnPoolManager) dial(ctx context.Context, pc *poolConn) (*poolH2Conn, error) {
+	if timeout := m.baseConf.Timeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	localIP, _, err := m.client.sourceAddr(&RequestConfig{})
+	if err != nil {
+		return nil, err
+	}
+
+	addr, sni := pc.addr, pc.ip
+	if m.baseConf.ServerName != "" {
+		sni = m.baseConf.ServerName
+	}
+	conn, err := m.client.dialUTLS(ctx, "tcp", addr, sni, &m.helloID, localIP, nil)
+	if err != nil {
+		return nil, err
+	}
+	if proto := negotiatedProtocol(conn); proto != protoHTTP2 {
+		conn.Close()
+		return nil, &Error{Stage: StageALPN, Addr: addr, Err: fmt.Errorf("服务器协商的协议为 %s，与要求的 %s 不一致", proto, protoHTTP2)}
+	}
+
+	c := &poolH2Conn{created: time.Now()}
+	frameConn := newH2FrameConn(conn, m.h2opts)
+	frameConn.reader.onGoAway = func(lastStreamID uint32, code http2.ErrCode, debugData []byte) {
+		pc.recordGoAway(c, lastStreamID, code, debugData)
+	}
+	cc, err := m.transport.NewClientConn(frameConn)
+	if err != nil {
+		conn.Close()
+		return nil, &Error{Stage: StageHTTP2, Addr: addr, Err: err}
+	}
+	if err := cc.Ping(ctx); err != nil {
+		cc.Close()
+		return nil, &Error{Stage: StageHTTP2, Addr: addr, Err: fmt.Errorf("PING 失败: %w", err)}
+	}
+	c.cc = cc
+	return c, nil
+}
+
+// keepAlive 定期 PING 保活；连接失效后从连接组移除，组内没有其他连接时重建一次（重建失败时等下一次请求再拨号）；
+// 额外的连接空闲超过 poolIdleConnTimeout 后关闭，达到最大存活时长的连接轮换；连接池关闭后退出（连接由 Close 关闭）
+func (m *ConnPoolManager) keepAlive(pc *poolConn, c *poolH2Conn) {
+	m.mu.RLock()
+	ticker := time.NewTicker(m.pingInterval)
+	lifetime := m.connLifetime()
+	m.mu.RUnlock()
+	defer ticker.Stop()
+
+	var expired <-chan time.Time
+	if lifetime > 0 {
+		timer := time.NewTimer(lifetime - time.Since(c.created))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+loop:
+	for {
+		select {
+		case <-m.life.done:
+			return
+		case <-expired:
+			m.rotate(pc, c)
+			return
+		case <-ticker.C:
+			if !usable(c.cc) || m.idleExtra(pc, c) {
+				break loop
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), poolPingTimeout)
+			err := c.cc.Ping(ctx)
+			cancel()
+			if err != nil {
+				break loop
+			}
+		}
+	}
+	c.cc.Close()
+
+	found, remaining := pc.remove(c)
+	if found && remaining == 0 && m.health.state(pc.key) == IPHealthy {
+		m.conn(context.Background(), pc.key, false)
+	}
+}
+
+// connLifetime 返回新连接的存活时长（0 表示不限；调用方持有 m.mu）
+func (m *ConnPoolManager) connLifetime() time.Duration {
+	if m.maxConnAge <= 0 {
+		return 0
+	}
+	if m.connAgeJitter <= 0 {
+		return m.maxConnAge
+	}
+	return m.maxConnAge - rand.N(m.connAgeJitter)
+}
+
+// rotate 轮换达到最大存活时长的连接：IP 仅剩这一条连接时先建立替换连接，避免出现没有连接的间隙；
+// 旧连接移出连接组后不再接收新请求，发送 GOAWAY 并等待进行中的流结束后关闭
+func (m *ConnPoolManager) rotate(pc *poolConn, c *poolH2Conn) {
+	pc.mu.Lock()
+	only := len(pc.conns) == 1 && pc.conns[0] == c
+	pc.mu.Unlock()
+
+	var next *poolH2Conn
+	if only && usable(c.cc) && !m.life.isClosed() && m.health.state(pc.key) == IPHealthy {
+		// 拨号失败时只移出旧连接，下一次请求再拨号
+		next, _ = m.dial(context.Background(), pc)
+	}
+
+	pc.mu.Lock()
+	i := slices.Index(pc.conns, c)
+	switch {
+	case i < 0 || m.life.isClosed():
+		// 连接已被隔离移除或连接池已关闭
+		if i >= 0 {
+			pc.conns = slices.Delete(pc.conns, i, i+1)
+		}
+		if next != nil {
+			next.cc.Close()
+			next = nil
+		}
+	case next != nil:
+		pc.conns[i] = next
+	default:
+		pc.conns = slices.Delete(pc.conns, i, i+1)
+	}
+	pc.mu.Unlock()
+	if next != nil {
+		go m.keepAlive(pc, next)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), poolShutdownTimeout)
+	defer cancel()
+	if err := c.cc.Shutdown(ctx); err != nil {
+		c.cc.Close()
+	}
+}
+
+// idleExtra 判断连接是否为空闲超时的额外连接（每个 IP 的第一条连接始终保留）
+func (m *ConnPoolManager) idleExtra(pc *poolConn, c *poolH2Conn) bool {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if len(pc.conns) == 0 || pc.conns[0] == c {
+		return false
+	}
+	state := c.cc.State()
+	return state.StreamsActive+state.StreamsReserved+state.StreamsPending == 0 &&
+		!state.LastIdle.IsZero() && time.Since(state.LastIdle) > poolIdleConnTimeout
+}
+
+// Close 关闭连接池：拒绝新请求（返回 ErrClosed），立即关闭所有连接（进行中的请求随之失败）
+func (m *ConnPoolManager) Close() error {
+	m.life.shutdown()
+	for _, pc := range m.slots() {
+		pc.mu.Lock()
+		for _, c := range pc.conns {
+			c.cc.Close()
+		}
+		pc.conns = nil
+		pc.mu.Unlock()
+	}
+	return nil
+}
+
+// Drain 排空连接池：拒绝新请求，等待进行中的请求结束后关闭所有连接
+// ctx 取消时不再等待，立即关闭所有连接并返回 ctx 的错误
+func (m *ConnPoolManager) Drain(ctx context.Context) error {
+	m.life.shutdown()
+	err := m.life.wait(ctx)
+	m.Close()
+	return err
+}
+
+// MarkResult 记录未经 Do 发送的请求结果（如经 Client 直接请求该 IP），计入健康状态；达到隔离条件时关闭其连接
+func (m *ConnPoolManager) MarkResult(remoteIP string, status int, err error) {
+	if m.health.record(remoteIP, false, status, err, 0, time.Now()) {
+		m.evict(remoteIP)
 	}
 }
 
-// BindLocalIPv6 为连接池设置统一的本地源IPv6（可选）
+// evict 关闭被隔离 IP 的连接（不再保活重建）
+func (m *ConnPoolManager) evict(remoteIP string) {
+	m.mu.RLock()
+	pc, ok := m.conns[remoteIP]
+	m.mu.RUnlock()
+	if !ok {
+		return
+	}
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	for _, c := range pc.conns {
+		c.cc.Close()
+	}
+	pc.conns = nil
+}
+
+// BindLocalIPv6 为连接池设置统一的本地源IPv6（可选，只影响之后建立的连接）
 func (m *ConnPoolManager) BindLocalIPv6(ip string) error {
 	if net.ParseIP(ip) == nil {
 		return fmt.Errorf("无效的IPv6: %s", ip)
 	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	if m.baseConf == nil {
-		m.baseConf = &Config{}
-	}
 	m.baseConf.LocalIP = ip
 	return nil
 }
+
+// queued 连接上进行中与排队等待的流数
+func queued(cc *http2.ClientConn) int {
+	state := cc.State()
+	return state.StreamsActive + state.StreamsReserved + state.StreamsPending
+}
+
+// freeStreams 连接的并发流是否未达服务端 SETTINGS_MAX_CONCURRENT_STREAMS
+// （预留在 pc.mu 下进行，检查后不会被其他请求抢占）
+func freeStreams(cc *http2.ClientConn) bool {
+	return queued(cc) < int(cc.State().MaxConcurrentStreams)
+}
+
+// usable 连接是否仍可发送新请求（未关闭且未收到 GOAWAY；流数达到上限时请求排队等待）
+func usable(cc *http2.ClientConn) bool {
+	state := cc.State()
+	return !state.Closed && !state.Closing
+}
+
+// splitPoolAddr 解析远端 IP（可带端口），返回 IP 与 ip:port
+func splitPoolAddr(remoteIP string) (ip, addr string, err error) {
+	ip, port := remoteIP, poolPort
+	if net.ParseIP(remoteIP) == nil {
+		if ip, port, err = net.SplitHostPort(remoteIP); err != nil || net.ParseIP(ip) == nil {
+			return "", "", fmt.Errorf("无效的远端 IP: %s", remoteIP)
+		}
+	}
+	return ip, net.JoinHostPort(ip, port), nil
+}
@@ -0,0 +1,402 @@
+package utls_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrIPQuarantined 远端 IP 处于隔离期（或正在探测），请求未发送
+var ErrIPQuarantined = errors.New("远端 IP 已被隔离")
+
+// IPState 远端 IP 的健康状态
+type IPState int
+
+const (
+	// IPHealthy 正常使用
+	IPHealthy IPState = iota
+	// IPQuarantined 隔离中：连接已关闭，隔离期内拒绝请求
+	IPQuarantined
+	// IPProbing 隔离期已过，下一次请求作为探测（同一时间只放行一个），成功后重新接纳
+	IPProbing
+)
+
+func (s IPState) String() string {
+	switch s {
+	case IPHealthy:
+		return "正常"
+	case IPQuarantined:
+		return "隔离"
+	case IPProbing:
+		return "探测"
+	}
+	return "未知"
+}
+
+// IPHealthOptions 远端 IP 的健康评估与隔离规则
+// 请求出错或返回 403、429、5xx 记为失败，其余状态码记为成功
+type IPHealthOptions struct {
+	// 滚动窗口大小：成功率与延迟分位数按最近多少次请求计算（默认 100）
+	Window int
+
+	// 连续失败多少次后隔离（默认 3）
+	MaxFailures int
+
+	// 窗口内请求数不少于 MinSamples 且成功率低于该值时隔离（默认 0，不按成功率隔离）
+	MinSuccessRate float64
+
+	// 按成功率隔离所需的最少请求数（默认 20）
+	MinSamples int
+
+	// 首次隔离时长（默认 30 秒）；探测失败或重新接纳后 MaxProbation 内再次被隔离时，隔离时长翻倍
+	Probation time.Duration
+
+	// 隔离时长上限（默认 30 分钟）
+	MaxProbation time.Duration
+}
+
+// withDefaults 填充默认值
+func (o IPHealthOptions) withDefaults() IPHealthOptions {
+	if o.Window <= 0 {
+		o.Window = 100
+	}
+	if o.MaxFailures <= 0 {
+		o.MaxFailures = 3
+	}
+	if o.MinSamples <= 0 {
+		o.MinSamples = 20
+	}
+	if o.Probation <= 0 {
+		o.Probation = 30 * time.Second
+	}
+	if o.MaxProbation <= 0 {
+		o.MaxProbation = 30 * time.Minute
+	}
+	return o
+}
+
+// IPStatus 远端 IP 健康状态快照
+type IPStatus struct {
+	IP    string
+	State IPState
+
+	// 是否持有可用的连接
+	Connected bool
+
+	// 滚动窗口内的请求数与成功率
+	Requests    int
+	SuccessRate float64
+
+	// 滚动窗口内成功请求的延迟分位数
+	LatencyP50 time.Duration
+	LatencyP90 time.Duration
+	LatencyP99 time.Duration
+
+	// 累计成功与失败次数
+	Successes           int64
+	Failures            int64
+	ConsecutiveFailures int
+
+	// 403 与 429 的累计次数与最近一次的时间
+	Forbidden           int64
+	LastForbidden       time.Time
+	TooManyRequests     int64
+	LastTooManyRequests time.Time
+
+	LastSuccess time.Time
+	LastFailure time.Time
+	LastError   string
+
+	// 最近一次被隔离的原因、隔离截止时间与累计隔离次数
+	QuarantineReason string
+	QuarantinedUntil time.Time
+	Quarantines      int
+}
+
+// ipSample 滚动窗口中的一次请求结果
+type ipSample struct {
+	ok      bool
+	latency time.Duration // 0 表示未测量（MarkResult 上报）
+}
+
+// ipHealth 一个远端 IP 的健康状态
+type ipHealth struct {
+	status  IPStatus
+	samples []ipSample // 环形缓冲
+	next    int
+
+	probing    bool          // 探测请求进行中
+	probation  time.Duration // 下一次隔离的时长
+	readmitted time.Time     // 最近一次重新接纳的时间
+
+	inFlight int           // 进行中的请求数
+	latency  time.Duration // 成功请求延迟的指数移动平均
+}
+
+// poolHealth 连接池各远端 IP 的健康状态
+type poolHealth struct {
+	mu   sync.Mutex
+	opts IPHealthOptions
+	ips  map[string]*ipHealth
+}
+
+func newPoolHealth() *poolHealth {
+	return &poolHealth{opts: IPHealthOptions{}.withDefaults(), ips: make(map[string]*ipHealth)}
+}
+
+// entry 返回远端 IP 的健康状态（调用方持有 mu）
+func (h *poolHealth) entry(ip string) *ipHealth {
+	e, ok := h.ips[ip]
+	if !ok {
+		e = &ipHealth{status: IPStatus{IP: ip}, probation: h.opts.Probation}
+		h.ips[ip] = e
+	}
+	return e
+}
+
+// admit 判断是否放行发往远端 IP 的请求；隔离期已过时放行一个探测请求（probe 为 true）
+// 放行的请求计入进行中请求数，结束后调用 release
+func (h *poolHealth) admit(ip string, now time.Time) (probe bool, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	e := h.entry(ip)
+	defer func() {
+		if err == nil {
+			e.inFlight++
+		}
+	}()
+	switch e.status.State {
+	case IPQuarantined:
+		if now.Before(e.status.QuarantinedUntil) {
+			return false, fmt.Errorf("%w（%s，至 %s）", ErrIPQuarantined, e.status.QuarantineReason, e.status.QuarantinedUntil.Format(time.TimeOnly))
+		}
+		e.status.State = IPProbing
+		fallthrough
+	case IPProbing:
+		if e.probing {
+			return false, fmt.Errorf("%w（探测中）", ErrIPQuarantined)
+		}
+		e.probing = true
+		return true, nil
+	}
+	return false, nil
+}
+
+// release 请求结束，减少进行中请求数
+func (h *poolHealth) release(ip string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entry(ip).inFlight--
+}
+
+// candidates 返回可以接收请求的候选 IP（排除隔离期内与正在探测的 IP）
+func (h *poolHealth) candidates(ips []string, now time.Time) []IPCandidate {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	candidates := make([]IPCandidate, 0, len(ips))
+	for _, ip := range ips {
+		e, ok := h.ips[ip]
+		if !ok {
+			candidates = append(candidates, IPCandidate{IP: ip, Score: 1})
+			continue
+		}
+		if (e.status.State == IPQuarantined && now.Before(e.status.QuarantinedUntil)) ||
+			(e.status.State != IPHealthy && e.probing) {
+			continue
+		}
+		candidates = append(candidates, IPCandidate{IP: ip, Score: e.score(), InFlight: e.inFlight, Latency: e.latency})
+	}
+	return candidates
+}
+
+// state 返回远端 IP 的健康状态
+func (h *poolHealth) state(ip string) IPState {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if e, ok := h.ips[ip]; ok {
+		return e.status.State
+	}
+	return IPHealthy
+}
+
+// record 记录一次请求结果（probe 表示该请求是 admit 放行的探测请求），返回 IP 是否因此被隔离（调用方应关闭其连接）
+// 调用方取消的请求不计入统计，只释放探测名额
+func (h *poolHealth) record(ip string, probe bool, status int, err error, latency time.Duration, now time.Time) (quarantined bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	e := h.entry(ip)
+	if probe {
+		e.probing = false
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	s := &e.status
+	switch status {
+	case http.StatusForbidden:
+		s.Forbidden++
+		s.LastForbidden = now
+	case http.StatusTooManyRequests:
+		s.TooManyRequests++
+		s.LastTooManyRequests = now
+	}
+	ok := err == nil && status != http.StatusForbidden && status != http.StatusTooManyRequests && status < 500
+	e.push(ipSample{ok: ok, latency: latency}, h.opts.Window)
+
+	if ok {
+		s.Successes++
+		s.ConsecutiveFailures = 0
+		s.LastSuccess = now
+		if latency > 0 {
+			if e.latency == 0 {
+				e.latency = latency
+			} else {
+				e.latency = (e.latency*4 + latency) / 5
+			}
+		}
+		if probe {
+			s.State, e.readmitted = IPHealthy, now
+		}
+		return false
+	}
+
+	s.Failures++
+	s.ConsecutiveFailures++
+	s.LastFailure = now
+	if err != nil {
+		s.LastError = err.Error()
+	} else {
+		s.LastError = fmt.Sprintf("状态码 %d", status)
+	}
+
+	var reason string
+	switch {
+	case probe:
+		reason = "探测失败: " + s.LastError
+	case s.State != IPHealthy:
+		// 隔离前发出的请求在隔离后才返回，只计入统计
+		return false
+	case s.ConsecutiveFailures >= h.opts.MaxFailures:
+		reason = fmt.Sprintf("连续失败 %d 次，最近一次: %s", s.ConsecutiveFailures, s.LastError)
+	case h.opts.MinSuccessRate > 0:
+		if n, rate := e.successRate(); n >= h.opts.MinSamples && rate < h.opts.MinSuccessRate {
+			reason = fmt.Sprintf("最近 %d 次请求成功率 %.0f%% 低于 %.0f%%", n, rate*100, h.opts.MinSuccessRate*100)
+		}
+	}
+	if reason == "" {
+		return false
+	}
+	e.quarantine(reason, now, h.opts)
+	return true
+}
+
+// quarantine 隔离远端 IP：重新接纳后 MaxProbation 内没有再被隔离时，隔离时长恢复为 Probation
+func (e *ipHealth) quarantine(reason string, now time.Time, opts IPHealthOptions) {
+	if !e.readmitted.IsZero() && now.Sub(e.readmitted) > opts.MaxProbation {
+		e.probation = opts.Probation
+	}
+	s := &e.status
+	s.State = IPQuarantined
+	s.QuarantineReason = reason
+	s.QuarantinedUntil = now.Add(e.probation)
+	s.Quarantines++
+	e.probation = min(e.probation*2, opts.MaxProbation)
+}
+
+// score 健康得分：滚动成功率按连续失败次数折减，等待探测的 IP 只保留少量权重
+func (e *ipHealth) score() float64 {
+	_, rate := e.successRate()
+	score := rate / float64(1+e.status.ConsecutiveFailures)
+	if e.status.State != IPHealthy {
+		score *= 0.1
+	}
+	return score
+}
+
+// push 向滚动窗口追加一次结果
+func (e *ipHealth) push(sample ipSample, window int) {
+	if len(e.samples) < window {
+		e.samples = append(e.samples, sample)
+		return
+	}
+	e.samples[e.next%len(e.samples)] = sample
+	e.next++
+}
+
+// successRate 滚动窗口内的请求数与成功率
+func (e *ipHealth) successRate() (int, float64) {
+	if len(e.samples) == 0 {
+		return 0, 1
+	}
+	ok := 0
+	for _, s := range e.samples {
+		if s.ok {
+			ok++
+		}
+	}
+	return len(e.samples), float64(ok) / float64(len(e.samples))
+}
+
+// snapshot 返回健康状态快照（含窗口统计）
+func (e *ipHealth) snapshot() IPStatus {
+	s := e.status
+	s.Requests, s.SuccessRate = e.successRate()
+	var latencies []time.Duration
+	for _, sample := range e.samples {
+		if sample.ok && sample.latency > 0 {
+			latencies = append(latencies, sample.latency)
+		}
+	}
+	if len(latencies) > 0 {
+		slices.Sort(latencies)
+		percentile := func(p float64) time.Duration {
+			return latencies[int(p*float64(len(latencies)-1))]
+		}
+		s.LatencyP50, s.LatencyP90, s.LatencyP99 = percentile(0.5), percentile(0.9), percentile(0.99)
+	}
+	return s
+}
+
+// SetHealthOptions 设置远端 IP 的健康评估与隔离规则（未设置的字段使用默认值）
+func (m *ConnPoolManager) SetHealthOptions(opts IPHealthOptions) {
+	m.health.mu.Lock()
+	defer m.health.mu.Unlock()
+	m.health.opts = opts.withDefaults()
+}
+
+// Health 返回各远端 IP 的健康状态快照（按 IP 排序），可据此查看 IP 被隔离的原因
+func (m *ConnPoolManager) Health() []IPStatus {
+	m.health.mu.Lock()
+	statuses := make([]IPStatus, 0, len(m.health.ips))
+	for _, e := range m.health.ips {
+		statuses = append(statuses, e.snapshot())
+	}
+	m.health.mu.Unlock()
+
+	for i := range statuses {
+		statuses[i].Connected = m.Warm(statuses[i].IP)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].IP < statuses[j].IP })
+	return statuses
+}
+
+// IPHealth 返回单个远端 IP 的健康状态快照
+func (m *ConnPoolManager) IPHealth(remoteIP string) (IPStatus, bool) {
+	m.health.mu.Lock()
+	e, ok := m.health.ips[remoteIP]
+	var status IPStatus
+	if ok {
+		status = e.snapshot()
+	}
+	m.health.mu.Unlock()
+	if ok {
+		status.Connected = m.Warm(remoteIP)
+	}
+	return status, ok
+}
@@ -0,0 +1,485 @@
+package utls_client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// CookieFileFormat Cookie 文件格式
+type CookieFileFormat int
+
+const (
+	// CookieFormatJSON 浏览器扩展导出的 JSON 数组（name、value、domain、path、expirationDate、hostOnly 等字段）
+	CookieFormatJSON CookieFileFormat = iota
+	// CookieFormatNetscape curl/wget 使用的 Netscape cookies.txt
+	CookieFormatNetscape
+)
+
+// CookieJar 可保存到文件的 Cookie 容器，实现 http.CookieJar
+// 匹配规则由 net/http/cookiejar（含公共后缀列表）处理，另记录每个 Cookie 的属性用于导出
+type CookieJar struct {
+	jar *cookiejar.Jar
+
+	mu      sync.Mutex
+	entries map[string]*jarEntry
+}
+
+// jarEntry 容器中的一个 Cookie（Domain 不带前导点）
+type jarEntry struct {
+	cookie   http.Cookie
+	hostOnly bool
+}
+
+// NewCookieJar 创建空的 Cookie 容器
+func NewCookieJar() *CookieJar {
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	return &CookieJar{jar: jar, entries: make(map[string]*jarEntry)}
+}
+
+// LoadCookieJar 从文件创建 Cookie 容器（格式自动识别）
+func LoadCookieJar(path string) (*CookieJar, error) {
+	jar := NewCookieJar()
+	if err := jar.Load(path); err != nil {
+		return nil, err
+	}
+	return jar, nil
+}
+
+// SetCookies 实现 http.CookieJar
+func (j *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.jar.SetCookies(u, cookies)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	for _, c := range cookies {
+		entry, remove, ok := newJarEntry(u, c, now)
+		if !ok {
+			continue
+		}
+		key := entry.cookie.Domain + ";" + entry.cookie.Path + ";" + entry.cookie.Name
+		if remove {
+			delete(j.entries, key)
+		} else {
+			j.entries[key] = entry
+		}
+	}
+}
+
+// Cookies 实现 http.CookieJar
+func (j *CookieJar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+// AllCookies 返回容器中所有未过期的 Cookie（含 Domain、Path、Expires 等属性，按域名排序）
+func (j *CookieJar) AllCookies() []*http.Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	cookies := make([]*http.Cookie, 0, len(j.entries))
+	for key, entry := range j.entries {
+		if !entry.cookie.Expires.IsZero() && !entry.cookie.Expires.After(now) {
+			delete(j.entries, key)
+			continue
+		}
+		c := entry.cookie
+		cookies = append(cookies, &c)
+	}
+	sort.Slice(cookies, func(a, b int) bool {
+		if cookies[a].Domain != cookies[b].Domain {
+			return cookies[a].Domain < cookies[b].Domain
+		}
+		if cookies[a].Path != cookies[b].Path {
+			return cookies[a].Path < cookies[b].Path
+		}
+		return cookies[a].Name < cookies[b].Name
+	})
+	return cookies
+}
+
+// newJarEntry 按 RFC 6265 确定 Cookie 的域名、路径与过期时间
+// remove 表示该 Cookie 用于删除已有 Cookie；ok 为 false 表示 Cookie 被拒绝
+func newJarEntry(u *url.URL, c *http.Cookie, now time.Time) (entry *jarEntry, remove, ok bool) {
+	host := normalizeHost(u.Hostname())
+	if host == "" || c.Name == "" {
+		return nil, false, false
+	}
+
+	entry = &jarEntry{cookie: http.Cookie{
+		Name:     c.Name,
+		Value:    c.Value,
+		Secure:   c.Secure,
+		HttpOnly: c.HttpOnly,
+		SameSite: c.SameSite,
+	}}
+
+	domain := normalizeHost(strings.TrimPrefix(c.Domain, "."))
+	switch {
+	case domain == "" || domain == host:
+		entry.cookie.Domain, entry.hostOnly = host, c.Domain == ""
+	case net.ParseIP(host) != nil || !strings.HasSuffix(host, "."+domain):
+		return nil, false, false
+	default:
+		// 不允许为公共后缀（如 com、co.uk）设置 Cookie
+		if suffix, _ := publicsuffix.PublicSuffix(domain); suffix == domain {
+			return nil, false, false
+		}
+		entry.cookie.Domain = domain
+	}
+
+	entry.cookie.Path = c.Path
+	if !strings.HasPrefix(c.Path, "/") {
+		entry.cookie.Path = defaultCookiePath(u.Path)
+	}
+
+	switch {
+	case c.MaxAge < 0:
+		return entry, true, true
+	case c.MaxAge > 0:
+		entry.cookie.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+	case !c.Expires.IsZero():
+		if !c.Expires.After(now) {
+			return entry, true, true
+		}
+		entry.cookie.Expires = c.Expires
+	}
+	return entry, false, true
+}
+
+// defaultCookiePath RFC 6265 5.1.4 的默认路径
+func defaultCookiePath(path string) string {
+	if path == "" || path[0] != '/' {
+		return "/"
+	}
+	i := strings.LastIndex(path, "/")
+	if i == 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+// jsonCookie 浏览器扩展（如 EditThisCookie、Cookie-Editor）导出的 Cookie 格式
+type jsonCookie struct {
+	Name           string  `json:"name"`
+	Value          string  `json:"value"`
+	Domain         string  `json:"domain"`
+	Path           string  `json:"path"`
+	ExpirationDate float64 `json:"expirationDate,omitempty"`
+	HostOnly       bool    `json:"hostOnly"`
+	HTTPOnly       bool    `json:"httpOnly"`
+	Secure         bool    `json:"secure"`
+	Session        bool    `json:"session"`
+	SameSite       string  `json:"sameSite,omitempty"`
+}
+
+// sameSiteNames SameSite 取值与 JSON 文件中名称的对应关系
+var sameSiteNames = map[http.SameSite]string{
+	http.SameSiteNoneMode:   "no_restriction",
+	http.SameSiteLaxMode:    "lax",
+	http.SameSiteStrictMode: "strict",
+}
+
+// Save 将所有未过期的 Cookie（含会话 Cookie）写入文件
+func (j *CookieJar) Save(path string, format CookieFileFormat) error {
+	var buf bytes.Buffer
+	switch format {
+	case CookieFormatJSON:
+		cookies := make([]jsonCookie, 0)
+		for _, entry := range j.allEntries() {
+			c := entry.cookie
+			jc := jsonCookie{
+				Name:     c.Name,
+				Value:    c.Value,
+				Domain:   c.Domain,
+				Path:     c.Path,
+				HostOnly: entry.hostOnly,
+				HTTPOnly: c.HttpOnly,
+				Secure:   c.Secure,
+				Session:  c.Expires.IsZero(),
+				SameSite: sameSiteNames[c.SameSite],
+			}
+			if !entry.hostOnly {
+				jc.Domain = "." + c.Domain
+			}
+			if !c.Expires.IsZero() {
+				jc.ExpirationDate = float64(c.Expires.UnixMilli()) / 1000
+			}
+			cookies = append(cookies, jc)
+		}
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(cookies); err != nil {
+			return fmt.Errorf("编码 Cookie 失败: %w", err)
+		}
+	case CookieFormatNetscape:
+		buf.WriteString("# Netscape HTTP Cookie File\n\n")
+		for _, entry := range j.allEntries() {
+			c := entry.cookie
+			domain := c.Domain
+			if !entry.hostOnly {
+				domain = "." + domain
+			}
+			if c.HttpOnly {
+				domain = "#HttpOnly_" + domain
+			}
+			var expires int64
+			if !c.Expires.IsZero() {
+				expires = c.Expires.Unix()
+			}
+			fmt.Fprintf(&buf, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+				domain, netscapeBool(!entry.hostOnly), c.Path, netscapeBool(c.Secure), expires, c.Name, c.Value)
+		}
+	default:
+		return fmt.Errorf("不支持的 Cookie 文件格式: %d", format)
+	}
+
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("保存 Cookie 失败: %w", err)
+	}
+	return nil
+}
+
+// Load 从文件加载 Cookie 并合并到容器（JSON 或 Netscape 格式自动识别，已过期的 Cookie 被忽略）
+func (j *CookieJar) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取 Cookie 文件失败: %w", err)
+	}
+
+	var entries []*jarEntry
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		entries, err = parseJSONCookies(trimmed)
+	} else {
+		entries, err = parseNetscapeCookies(data)
+	}
+	if err != nil {
+		return fmt.Errorf("解析 Cookie 文件 %s 失败: %w", path, err)
+	}
+
+	now := time.Now()
+	for _, entry := range entries {
+		c := entry.cookie
+		if !c.Expires.IsZero() && !c.Expires.After(now) {
+			continue
+		}
+		// 以 Cookie 所属的源重新设置（https 以便接受 Secure Cookie）
+		u := &url.URL{Scheme: "https", Host: c.Domain, Path: c.Path}
+		if entry.hostOnly {
+			c.Domain = ""
+		}
+		j.SetCookies(u, []*http.Cookie{&c})
+	}
+	return nil
+}
+
+// allEntries 返回未过期 Cookie 的记录副本
+func (j *CookieJar) allEntries() []*jarEntry {
+	cookies := j.AllCookies()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entries := make([]*jarEntry, 0, len(cookies))
+	for _, c := range cookies {
+		if entry, ok := j.entries[c.Domain+";"+c.Path+";"+c.Name]; ok {
+			entries = append(entries, &jarEntry{cookie: *c, hostOnly: entry.hostOnly})
+		}
+	}
+	return entries
+}
+
+// parseJSONCookies 解析浏览器扩展导出的 JSON Cookie
+func parseJSONCookies(data []byte) ([]*jarEntry, error) {
+	var cookies []jsonCookie
+	if err := json.Unmarshal(data, &cookies); err != nil {
+		return nil, err
+	}
+	entries := make([]*jarEntry, 0, len(cookies))
+	for _, jc := range cookies {
+		entry := &jarEntry{
+			cookie: http.Cookie{
+				Name:     jc.Name,
+				Value:    jc.Value,
+				Domain:   strings.TrimPrefix(jc.Domain, "."),
+				Path:     jc.Path,
+				Secure:   jc.Secure,
+				HttpOnly: jc.HTTPOnly,
+			},
+			hostOnly: jc.HostOnly,
+		}
+		for mode, name := range sameSiteNames {
+			if name == jc.SameSite {
+				entry.cookie.SameSite = mode
+			}
+		}
+		if !jc.Session && jc.ExpirationDate > 0 {
+			sec, frac := math.Modf(jc.ExpirationDate)
+			entry.cookie.Expires = time.Unix(int64(sec), int64(frac*1e9))
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// parseNetscapeCookies 解析 Netscape cookies.txt（支持 #HttpOnly_ 前缀）
+func parseNetscapeCookies(data []byte) ([]*jarEntry, error) {
+	var entries []*jarEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := strings.HasPrefix(text, "#HttpOnly_")
+		if httpOnly {
+			text = strings.TrimPrefix(text, "#HttpOnly_")
+		}
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Split(text, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("第 %d 行字段数为 %d，期望 7", line, len(fields))
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行过期时间无效: %w", line, err)
+		}
+		entry := &jarEntry{
+			cookie: http.Cookie{
+				Name:     fields[5],
+				Value:    fields[6],
+				Domain:   strings.TrimPrefix(fields[0], "."),
+				Path:     fields[2],
+				Secure:   strings.EqualFold(fields[3], "TRUE"),
+				HttpOnly: httpOnly,
+			},
+			hostOnly: !strings.EqualFold(fields[1], "TRUE"),
+		}
+		if expires > 0 {
+			entry.cookie.Expires = time.Unix(expires, 0)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+func netscapeBool(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// CookieJars 按会话区分的 Cookie 容器集合，一个 Client 可同时持有多个身份
+type CookieJars struct {
+	mu   sync.Mutex
+	jars map[string]*CookieJar
+}
+
+// NewCookieJars 创建空的会话 Cookie 容器集合
+func NewCookieJars() *CookieJars {
+	return &CookieJars{jars: make(map[string]*CookieJar)}
+}
+
+// Jar 返回会话的 Cookie 容器（不存在时创建；空会话为默认身份）
+func (s *CookieJars) Jar(session string) *CookieJar {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jar, ok := s.jars[session]
+	if !ok {
+		jar = NewCookieJar()
+		s.jars[session] = jar
+	}
+	return jar
+}
+
+// Sessions 返回所有会话名（已排序）
+func (s *CookieJars) Sessions() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessions := make([]string, 0, len(s.jars))
+	for session := range s.jars {
+		sessions = append(sessions, session)
+	}
+	sort.Strings(sessions)
+	return sessions
+}
+
+// Delete 删除会话及其 Cookie
+func (s *CookieJars) Delete(session string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.jars, session)
+}
+
+// cookieFileExt 会话 Cookie 文件的扩展名
+var cookieFileExt = map[CookieFileFormat]string{
+	CookieFormatJSON:     ".cookies.json",
+	CookieFormatNetscape: ".cookies.txt",
+}
+
+// SaveDir 将每个会话保存为 dir 下的一个文件（文件名为转义后的会话名）
+func (s *CookieJars) SaveDir(dir string, format CookieFileFormat) error {
+	ext, ok := cookieFileExt[format]
+	if !ok {
+		return fmt.Errorf("不支持的 Cookie 文件格式: %d", format)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("创建 Cookie 目录失败: %w", err)
+	}
+	for _, session := range s.Sessions() {
+		if err := s.Jar(session).Save(filepath.Join(dir, url.PathEscape(session)+ext), format); err != nil {
+			return fmt.Errorf("会话 %q: %w", session, err)
+		}
+	}
+	return nil
+}
+
+// LoadDir 加载 SaveDir 保存的所有会话文件（目录不存在时不做任何事）
+func (s *CookieJars) LoadDir(dir string) error {
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取 Cookie 目录失败: %w", err)
+	}
+	for _, file := range files {
+		for _, ext := range cookieFileExt {
+			name, ok := strings.CutSuffix(file.Name(), ext)
+			if !ok || file.IsDir() {
+				continue
+			}
+			session, err := url.PathUnescape(name)
+			if err != nil {
+				return fmt.Errorf("无效的会话文件名 %s: %w", file.Name(), err)
+			}
+			if err := s.Jar(session).Load(filepath.Join(dir, file.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// cookieJar 返回请求使用的 Cookie 容器（未配置时为 nil）
+func (c *Client) cookieJar(req *RequestConfig) http.CookieJar {
+	if c.config.CookieJars != nil {
+		return c.config.CookieJars.Jar(req.CookieSession)
+	}
+	return c.config.Jar
+}
@@ -0,0 +1,136 @@
+package utls_client
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// defaultAcceptEncoding 启用自动解码且调用方未设置 Accept-Encoding 时发送的值（与 Chrome 一致）
+const defaultAcceptEncoding = "gzip, deflate, br, zstd"
+
+// countingReader 统计经过的字节数（用于记录压缩前的传输大小）
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// decodedBody 解码后的响应体，关闭时释放所有解码器并关闭原始响应体
+type decodedBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (d *decodedBody) Close() error {
+	var firstErr error
+	for i := len(d.closers) - 1; i >= 0; i-- {
+		if err := d.closers[i].Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// decodeResponseBody 按 Content-Encoding 包装响应体的解码器
+// 多层编码（如 "gzip, br"）按逆序逐层解码；存在不支持的编码时保持原样不解码。
+// 解码后移除 Content-Encoding/Content-Length 头部；未解码时返回 nil
+func decodeResponseBody(resp *http.Response, wire *countingReader) (io.ReadCloser, error) {
+	encoding := strings.TrimSpace(resp.Header.Get("Content-Encoding"))
+	if encoding == "" || strings.EqualFold(encoding, "identity") {
+		return nil, nil
+	}
+
+	var codings []string
+	for _, coding := range strings.Split(encoding, ",") {
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		switch coding {
+		case "", "identity":
+		case "gzip", "x-gzip", "deflate", "br", "zstd":
+			codings = append(codings, coding)
+		default:
+			return nil, nil
+		}
+	}
+
+	decoded := &decodedBody{Reader: wire, closers: []io.Closer{resp.Body}}
+	for i := len(codings) - 1; i >= 0; i-- {
+		r, closer, err := newContentDecoder(codings[i], decoded.Reader)
+		if err == io.EOF {
+			// 空响应体（如 HEAD、204）携带 Content-Encoding 时无需解码
+			decoded.Reader = eofReader{}
+			break
+		}
+		if err != nil {
+			decoded.Close()
+			return nil, fmt.Errorf("创建 %s 解码器失败: %w", codings[i], err)
+		}
+		decoded.Reader = r
+		if closer != nil {
+			decoded.closers = append(decoded.closers, closer)
+		}
+	}
+
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return decoded, nil
+}
+
+// eofReader 空读取器
+type eofReader struct{}
+
+func (eofReader) Read([]byte) (int, error) { return 0, io.EOF }
+
+// newContentDecoder 创建单层内容解码器
+func newContentDecoder(coding string, r io.Reader) (io.Reader, io.Closer, error) {
+	switch coding {
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, zr, nil
+	case "deflate":
+		// 规范要求 zlib 封装，但部分服务端发送裸 deflate 流，按头部自动识别
+		br := bufio.NewReader(r)
+		if header, err := br.Peek(2); err == nil && isZlibHeader(header) {
+			zr, err := zlib.NewReader(br)
+			if err != nil {
+				return nil, nil, err
+			}
+			return zr, zr, nil
+		}
+		fr := flate.NewReader(br)
+		return fr, fr, nil
+	case "br":
+		return brotli.NewReader(r), nil, nil
+	case "zstd":
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, nil, err
+		}
+		rc := zr.IOReadCloser()
+		return rc, rc, nil
+	}
+	return nil, nil, fmt.Errorf("不支持的内容编码: %s", coding)
+}
+
+// isZlibHeader 判断是否为 zlib 头部（CM=8 且校验位正确）
+func isZlibHeader(h []byte) bool {
+	return h[0]&0x0f == 8 && (uint16(h[0])<<8|uint16(h[1]))%31 == 0
+}
@@ -0,0 +1,273 @@
+package utls_client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// DialMode TCP 拨号策略
+type DialMode int
+
+const (
+	// DialSequential 按解析结果的顺序逐个尝试地址（默认）
+	DialSequential DialMode = iota
+	// DialHappyEyeballs 按 RFC 8305 交替 IPv6/IPv4 地址，每隔 HappyEyeballsDelay 发起下一次尝试，先连上者胜出
+	DialHappyEyeballs
+)
+
+// 地址族
+const (
+	FamilyIPv4 = "ipv4"
+	FamilyIPv6 = "ipv6"
+)
+
+// defaultHappyEyeballsDelay RFC 8305 推荐的连接尝试间隔
+const defaultHappyEyeballsDelay = 250 * time.Millisecond
+
+// 地址族连续失败 familyMaxFailures 次后，familyCooldown 内竞速时不再优先使用该地址族
+const (
+	familyMaxFailures = 3
+	familyCooldown    = 30 * time.Second
+)
+
+// errFamilyTooSlow 先发起的地址族在错开时间内未连上，输给了另一地址族
+var errFamilyTooSlow = errors.New("连接慢于另一地址族")
+
+// FamilyStatus 地址族健康状态快照
+type FamilyStatus struct {
+	Family              string
+	Healthy             bool
+	Successes           int64
+	Failures            int64
+	ConsecutiveFailures int
+	LastError           string
+	LastFailure         time.Time
+}
+
+// familyHealth 按地址族统计的连接健康状态
+type familyHealth struct {
+	mu    sync.Mutex
+	stats map[string]*FamilyStatus
+}
+
+// report 记录一次连接结果（err 为 nil 表示成功）
+func (h *familyHealth) report(family string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.stats == nil {
+		h.stats = make(map[string]*FamilyStatus)
+	}
+	s, ok := h.stats[family]
+	if !ok {
+		s = &FamilyStatus{Family: family}
+		h.stats[family] = s
+	}
+	if err == nil {
+		s.Successes++
+		s.ConsecutiveFailures = 0
+		return
+	}
+	s.Failures++
+	s.ConsecutiveFailures++
+	s.LastError = err.Error()
+	s.LastFailure = time.Now()
+}
+
+// healthy 判断地址族当前是否可优先使用
+func (h *familyHealth) healthy(family string, now time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.stats[family]
+	return !ok || statusHealthy(s, now)
+}
+
+// snapshot 返回各地址族的健康状态（IPv6 在前）
+func (h *familyHealth) snapshot() []FamilyStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	var statuses []FamilyStatus
+	for _, family := range []string{FamilyIPv6, FamilyIPv4} {
+		if s, ok := h.stats[family]; ok {
+			status := *s
+			status.Healthy = statusHealthy(s, now)
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
+
+func statusHealthy(s *FamilyStatus, now time.Time) bool {
+	return s.ConsecutiveFailures < familyMaxFailures || now.Sub(s.LastFailure) >= familyCooldown
+}
+
+// FamilyHealth 返回 IPv4/IPv6 的连接健康状态（只统计经本客户端解析并拨号的连接）
+func (c *Client) FamilyHealth() []FamilyStatus {
+	return c.families.snapshot()
+}
+
+// addressFamily 返回地址所属的地址族
+func addressFamily(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		return FamilyIPv6
+	}
+	return FamilyIPv4
+}
+
+// remoteFamily 返回连接对端地址及其地址族
+func remoteFamily(addr net.Addr) (string, string) {
+	if addr == nil {
+		return "", ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String(), ""
+	}
+	return addr.String(), addressFamily(host)
+}
+
+// dialTCP 建立 TCP 连接（绑定 localIP）
+// 配置了 Resolver 或 Happy Eyeballs 时由本客户端解析域名，否则交给系统解析
+func (c *Client) dialTCP(ctx context.Context, network, addr, localIP string) (net.Conn, error) {
+	dialer := c.newDialer(localIP)
+	host, port, err := net.SplitHostPort(addr)
+	happyEyeballs := c.config.DialMode == DialHappyEyeballs
+	if (c.config.Resolver == nil && !happyEyeballs) || err != nil || net.ParseIP(host) != nil {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	ips, err := c.lookupHost(ctx, host, localIP)
+	if err != nil {
+		return nil, err
+	}
+	ips = avoidIPs(ips, retryDialFrom(ctx).avoid)
+	if happyEyeballs {
+		return c.dialHappyEyeballs(ctx, dialer, network, port, ips)
+	}
+
+	var lastErr error
+	for _, ip := range ips {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// dialHappyEyeballs 按 RFC 8305 竞速连接：地址按族交替排列，每隔错开时间或上一次尝试失败时发起下一次尝试，
+// 第一个连上的连接胜出，其余尝试被取消；结果计入地址族健康状态
+func (c *Client) dialHappyEyeballs(ctx context.Context, dialer *net.Dialer, network, port string, ips []string) (net.Conn, error) {
+	ips = c.interleaveFamilies(ips)
+	delay := c.config.HappyEyeballsDelay
+	if delay <= 0 {
+		delay = defaultHappyEyeballsDelay
+	}
+
+	type dialResult struct {
+		conn net.Conn
+		ip   string
+		err  error
+	}
+	raceCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan dialResult, len(ips))
+
+	next, pending := 0, 0
+	start := func() {
+		ip := ips[next]
+		next++
+		pending++
+		go func() {
+			conn, err := dialer.DialContext(raceCtx, network, net.JoinHostPort(ip, port))
+			results <- dialResult{conn: conn, ip: ip, err: err}
+		}()
+	}
+
+	start()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	failed := make(map[string]bool)
+	var lastErr error
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				cancel()
+				// 关闭竞速中随后连上的连接
+				go func(n int) {
+					for ; n > 0; n-- {
+						if late := <-results; late.conn != nil {
+							late.conn.Close()
+						}
+					}
+				}(pending)
+
+				family := addressFamily(r.ip)
+				c.families.report(family, nil)
+				if first := addressFamily(ips[0]); first != family && !failed[first] {
+					c.families.report(first, errFamilyTooSlow)
+				}
+				return r.conn, nil
+			}
+
+			lastErr = r.err
+			if ctx.Err() == nil {
+				family := addressFamily(r.ip)
+				failed[family] = true
+				c.families.report(family, r.err)
+			}
+			if next < len(ips) && ctx.Err() == nil {
+				start()
+				timer.Reset(delay)
+			}
+		case <-timer.C:
+			if next < len(ips) {
+				start()
+				timer.Reset(delay)
+			}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return nil, lastErr
+}
+
+// interleaveFamilies 按地址族交替排列地址，优先使用健康的地址族（默认 IPv6 优先）
+func (c *Client) interleaveFamilies(ips []string) []string {
+	var v4, v6 []string
+	for _, ip := range ips {
+		if addressFamily(ip) == FamilyIPv6 {
+			v6 = append(v6, ip)
+		} else {
+			v4 = append(v4, ip)
+		}
+	}
+
+	first, second := v6, v4
+	now := time.Now()
+	if !c.families.healthy(FamilyIPv6, now) && c.families.healthy(FamilyIPv4, now) {
+		first, second = v4, v6
+	}
+
+	ordered := make([]string, 0, len(ips))
+	for i := 0; i < len(first) || i < len(second); i++ {
+		if i < len(first) {
+			ordered = append(ordered, first[i])
+		}
+		if i < len(second) {
+			ordered = append(ordered, second[i])
+		}
+	}
+	return ordered
+}
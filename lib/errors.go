@@ -0,0 +1,165 @@
+package utls_client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"syscall"
+
+	utls "github.com/refraction-networking/utls"
+	"golang.org/x/net/http2"
+)
+
+// ErrorStage 请求出错的阶段
+type ErrorStage int
+
+const (
+	// StageRequest 发送请求或读取响应头（不属于以下阶段的请求错误）
+	StageRequest ErrorStage = iota
+	// StageResolve 域名解析
+	StageResolve
+	// StageConnect TCP 连接
+	StageConnect
+	// StageProxy 选择代理、连接代理或代理握手
+	StageProxy
+	// StageTLS TLS 握手
+	StageTLS
+	// StageALPN ALPN 协商结果与要求的协议不一致
+	StageALPN
+	// StageHTTP2 HTTP/2 流错误、连接错误或 GOAWAY
+	StageHTTP2
+	// StageBody 读取响应体
+	StageBody
+)
+
+// 各阶段的哨兵错误，配合 errors.Is 判断错误类别
+var (
+	ErrRequest      = errors.New("请求失败")
+	ErrResolve      = errors.New("域名解析失败")
+	ErrConnect      = errors.New("TCP 连接失败")
+	ErrProxy        = errors.New("代理连接失败")
+	ErrTLSHandshake = errors.New("TLS 握手失败")
+	ErrALPNMismatch = errors.New("ALPN 协商不一致")
+	ErrHTTP2        = errors.New("HTTP/2 错误")
+	ErrReadBody     = errors.New("读取响应体失败")
+
+	// ErrTimeout 任一阶段超时（含 Config.Timeout 与 ctx 截止时间）
+	ErrTimeout = errors.New("超时")
+)
+
+// stageErrors 阶段对应的哨兵错误
+var stageErrors = [...]error{
+	StageRequest: ErrRequest,
+	StageResolve: ErrResolve,
+	StageConnect: ErrConnect,
+	StageProxy:   ErrProxy,
+	StageTLS:     ErrTLSHandshake,
+	StageALPN:    ErrALPNMismatch,
+	StageHTTP2:   ErrHTTP2,
+	StageBody:    ErrReadBody,
+}
+
+// String 返回阶段的描述
+func (s ErrorStage) String() string {
+	if s >= 0 && int(s) < len(stageErrors) {
+		return stageErrors[s].Error()
+	}
+	return "未知阶段"
+}
+
+// Error 客户端请求错误，记录出错阶段与对端地址
+// errors.Is(err, ErrTLSHandshake) 等按阶段判断，errors.Is(err, ErrTimeout) 判断是否超时；
+// 经代理时代理阶段的错误包裹代理内部的连接错误，errors.As 取得的是最外层（代理）阶段
+type Error struct {
+	// 出错阶段
+	Stage ErrorStage
+
+	// 对端地址（域名解析阶段为域名，代理阶段为代理链，直连的 TLS 握手阶段为实际连接的 IP:端口，
+	// 其余为请求的 host:port；读取响应体时为空）
+	Addr string
+
+	// 原始错误
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Addr == "" {
+		return e.Stage.String() + ": " + e.Err.Error()
+	}
+	return e.Stage.String() + "（" + e.Addr + "）: " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Is 匹配阶段对应的哨兵错误；超时错误同时匹配 ErrTimeout
+func (e *Error) Is(target error) bool {
+	if target == ErrTimeout {
+		return e.Timeout()
+	}
+	return e.Stage >= 0 && int(e.Stage) < len(stageErrors) && target == stageErrors[e.Stage]
+}
+
+// Timeout 是否为超时错误
+func (e *Error) Timeout() bool {
+	var netErr net.Error
+	return errors.Is(e.Err, context.DeadlineExceeded) || (errors.As(e.Err, &netErr) && netErr.Timeout())
+}
+
+// TLSAlert 返回错误中的 TLS 告警码；remote 表示告警由对端发送（如被中间设备拦截时常见的 handshake_failure），
+// 否则为本端发送（如证书校验失败时的 bad_certificate）
+func TLSAlert(err error) (alert utls.AlertError, remote, ok bool) {
+	// uTLS 与 crypto/tls 收发告警时返回 *net.OpError{Op: "remote error"/"local error"}，告警类型未导出，按底层 uint8 取值
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && (opErr.Op == "remote error" || opErr.Op == "local error") {
+		if v := reflect.ValueOf(opErr.Err); v.Kind() == reflect.Uint8 {
+			return utls.AlertError(v.Uint()), opErr.Op == "remote error", true
+		}
+	}
+	if errors.As(err, &alert) {
+		return alert, false, true
+	}
+	return 0, false, false
+}
+
+// HandshakeRejected 判断错误是否为对端拒绝 TLS 握手：收到对端的告警，或握手中连接被重置、关闭（多为针对该 IP 的封锁）
+// 本端产生的握手失败（证书链或主机名校验失败、公钥固定不匹配、本端发送的告警）与超时不算
+func HandshakeRejected(err error) bool {
+	if !errors.Is(err, ErrTLSHandshake) || errors.Is(err, ErrTimeout) {
+		return false
+	}
+	if _, remote, ok := TLSAlert(err); ok {
+		return remote
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// stageError 包装为指定阶段的错误（已是 *Error 的错误保持原阶段）
+func stageError(stage ErrorStage, addr string, err error) error {
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return &Error{Stage: stage, Addr: addr, Err: err}
+}
+
+// dialStage 区分拨号错误属于域名解析还是 TCP 连接（系统解析失败时拨号返回 *net.DNSError）
+func dialStage(err error) ErrorStage {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return StageResolve
+	}
+	return StageConnect
+}
+
+// requestStage 区分发送请求时的错误是否来自 HTTP/2 层
+func requestStage(err error) ErrorStage {
+	var goAway http2.GoAwayError
+	var streamErr http2.StreamError
+	var connErr http2.ConnectionError
+	if errors.As(err, &goAway) || errors.As(err, &streamErr) || errors.As(err, &connErr) {
+		return StageHTTP2
+	}
+	return StageRequest
+}
@@ -0,0 +1,188 @@
+package utls_client
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// h1 写入状态
+const (
+	h1StateHead    = iota // 正在写入请求头
+	h1StateBody           // 正在写入定长请求体
+	h1StateChunked        // 正在写入分块请求体
+)
+
+// h1OrderConn 在 HTTP/1.1 连接上按内部顺序头部重排请求头
+// net/http 总是按字母序、以规范键写出头部，这里在请求头写入连接前重排、恢复名称大小写并剥离内部头部；
+// 通过 Content-Length / chunked 跟踪请求体边界，保证长连接上的后续请求同样被处理
+type h1OrderConn struct {
+	net.Conn
+
+	mu         sync.Mutex
+	state      int
+	head       []byte
+	bodyRemain int64
+	chunked    chunkedScanner
+}
+
+func newH1OrderConn(conn net.Conn) *h1OrderConn {
+	return &h1OrderConn{Conn: conn}
+}
+
+func (c *h1OrderConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var out bytes.Buffer
+	rest := p
+	for len(rest) > 0 {
+		switch c.state {
+		case h1StateHead:
+			c.head = append(c.head, rest...)
+			rest = nil
+			end := bytes.Index(c.head, []byte("\r\n\r\n"))
+			if end < 0 {
+				continue
+			}
+			head, tail := c.head[:end+4], c.head[end+4:]
+			out.Write(c.rewriteHead(head))
+			rest = append([]byte(nil), tail...)
+			c.head = c.head[:0]
+		case h1StateBody:
+			n := int64(len(rest))
+			if n > c.bodyRemain {
+				n = c.bodyRemain
+			}
+			out.Write(rest[:n])
+			rest = rest[n:]
+			c.bodyRemain -= n
+			if c.bodyRemain == 0 {
+				c.state = h1StateHead
+			}
+		case h1StateChunked:
+			n, done := c.chunked.scan(rest)
+			out.Write(rest[:n])
+			rest = rest[n:]
+			if done {
+				c.state = h1StateHead
+			}
+		}
+	}
+
+	if out.Len() > 0 {
+		if _, err := c.Conn.Write(out.Bytes()); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// rewriteHead 重排请求头并根据请求体编码切换写入状态
+func (c *h1OrderConn) rewriteHead(head []byte) []byte {
+	lines := strings.Split(strings.TrimSuffix(string(head), "\r\n\r\n"), "\r\n")
+	requestLine, fields := lines[0], lines[1:]
+
+	var order []string
+	kept := fields[:0]
+	for _, line := range fields {
+		name, value, _ := strings.Cut(line, ":")
+		if strings.EqualFold(name, headerOrderKey) {
+			order = parseHeaderOrder(strings.TrimSpace(value))
+			continue
+		}
+		kept = append(kept, line)
+	}
+	fields = orderByName(kept, order, func(line string) string {
+		name, _, _ := strings.Cut(line, ":")
+		return name
+	})
+
+	// 头部以规范键写出，按顺序列表恢复调用方给出的名称大小写
+	for i, line := range fields {
+		name, value, _ := strings.Cut(line, ":")
+		for _, wire := range order {
+			if wire != name && strings.EqualFold(wire, name) {
+				fields[i] = wire + ":" + value
+				break
+			}
+		}
+	}
+
+	// 确定请求体边界
+	c.state = h1StateHead
+	for _, line := range fields {
+		name, value, _ := strings.Cut(line, ":")
+		value = strings.TrimSpace(value)
+		switch {
+		case strings.EqualFold(name, "Transfer-Encoding") && strings.Contains(strings.ToLower(value), "chunked"):
+			c.state = h1StateChunked
+			c.chunked = chunkedScanner{}
+		case strings.EqualFold(name, "Content-Length") && c.state != h1StateChunked:
+			if n, err := strconv.ParseInt(value, 10, 64); err == nil && n > 0 {
+				c.state = h1StateBody
+				c.bodyRemain = n
+			}
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(requestLine)
+	b.WriteString("\r\n")
+	for _, line := range fields {
+		b.WriteString(line)
+		b.WriteString("\r\n")
+	}
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
+
+// chunkedScanner 识别分块编码请求体的结束位置（不修改数据）
+type chunkedScanner struct {
+	line    []byte
+	remain  int64 // 当前块剩余字节（含结尾 CRLF）
+	trailer bool  // 已读到末尾块，正在跳过尾部头部
+}
+
+// scan 返回 p 中属于当前分块请求体的字节数，以及请求体是否结束
+func (s *chunkedScanner) scan(p []byte) (n int, done bool) {
+	for n < len(p) {
+		if s.remain > 0 {
+			k := int64(len(p) - n)
+			if k > s.remain {
+				k = s.remain
+			}
+			n += int(k)
+			s.remain -= k
+			continue
+		}
+
+		b := p[n]
+		n++
+		if b != '\n' {
+			s.line = append(s.line, b)
+			continue
+		}
+
+		line := strings.TrimRight(string(s.line), "\r")
+		s.line = s.line[:0]
+		if s.trailer {
+			if line == "" {
+				*s = chunkedScanner{}
+				return n, true
+			}
+			continue
+		}
+
+		sizeStr, _, _ := strings.Cut(line, ";")
+		size, err := strconv.ParseInt(strings.TrimSpace(sizeStr), 16, 64)
+		if err != nil || size == 0 {
+			s.trailer = true
+			continue
+		}
+		s.remain = size + 2
+	}
+	return n, false
+}
@@ -0,0 +1,410 @@
+package utls_client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+
+	"utls_client/fingerprint"
+)
+
+const (
+	// h2FrameHeaderLen HTTP/2 帧头长度
+	h2FrameHeaderLen = 9
+	// h2MaxFramePayload 改写后单帧负载上限（协议允许的最小 MAX_FRAME_SIZE，任何服务端都能接受）
+	h2MaxFramePayload = 16384
+	// h2HeaderTableSize 改写使用的 HPACK 动态表大小（协议默认值）
+	h2HeaderTableSize = 4096
+)
+
+// h2ConnOptions HTTP/2 帧改写选项
+type h2ConnOptions struct {
+	// 伪头部顺序（为空表示保持原顺序）
+	pseudoOrder []string
+
+	// HTTP/2 指纹（为空表示不改写连接前言与优先级）
+	profile *fingerprint.HTTP2Profile
+}
+
+// newHTTP2Transport 创建与 HTTP/2 指纹一致的 Transport
+// 连接前言由 h2FrameConn 按指纹改写，Transport 自身的流控窗口与 HPACK 解码表必须与通告值一致：
+// 否则服务端按通告的窗口发送数据时会被 Transport 判定为流控错误
+func newHTTP2Transport(profile *fingerprint.HTTP2Profile, singleUse bool) *http2.Transport {
+	// 窗口大小只能通过 net/http 的 HTTP2Config 设置；
+	// DisableKeepAlives 使连接只承载一个请求（一次性源地址）
+	t1 := &http.Transport{DisableCompression: true, DisableKeepAlives: singleUse}
+	if profile != nil {
+		t1.HTTP2 = &http.HTTP2Config{
+			MaxReceiveBufferPerStream:     int(profile.InitialWindowSize()),
+			MaxReceiveBufferPerConnection: int(profile.ConnectionFlow),
+		}
+	}
+	transport, err := http2.ConfigureTransports(t1)
+	if err != nil {
+		transport = &http2.Transport{}
+	}
+	// ConfigureTransports 使用不主动拨号的连接池，恢复为默认连接池
+	transport.ConnPool = nil
+
+	transport.ReadIdleTimeout = 30 * time.Second
+	transport.PingTimeout = 15 * time.Second
+	transport.WriteByteTimeout = 10 * time.Second
+	transport.MaxReadFrameSize = 1 << 20
+	transport.AllowHTTP = false
+	// 解码统一由 Config.AutoDecompress 控制，避免 Transport 自行追加 Accept-Encoding: gzip
+	transport.DisableCompression = true
+
+	if profile != nil {
+		transport.MaxDecoderHeaderTableSize = profile.HeaderTableSize()
+		if v, ok := profile.Setting(fingerprint.HTTP2SettingMaxHeaderListSize); ok {
+			transport.MaxHeaderListSize = v
+		}
+	}
+	return transport
+}
+
+// h2FrameConn 在 HTTP/2 连接上改写客户端发出的 HEADERS 帧
+// x/net/http2 的伪头部与普通头部顺序不可配置，这里在帧写入连接前解码头部块、
+// 按指纹重排后重新编码。解码器与 Transport 的编码器保持同步，编码器与服务端的解码器保持同步
+type h2FrameConn struct {
+	net.Conn
+	opts h2ConnOptions
+
+	wmu         sync.Mutex
+	wbuf        []byte
+	prefaceDone bool
+	out         bytes.Buffer
+	framer      *http2.Framer
+
+	// 连接前言中的 SETTINGS / WINDOW_UPDATE 是否已按指纹改写
+	settingsDone bool
+	windowDone   bool
+
+	// 跨 CONTINUATION 帧累积的头部块
+	pendingBlock    []byte
+	pendingStreamID uint32
+	pendingFlags    http2.Flags
+	pendingPriority http2.PriorityParam
+
+	dec    *hpack.Decoder
+	enc    *hpack.Encoder
+	encBuf bytes.Buffer
+
+	// 读方向：被动解析服务端帧，跟踪 SETTINGS_HEADER_TABLE_SIZE
+	reader           h2FrameObserver
+	pendingTableSize atomic.Int64 // 待生效的动态表大小，-1 表示无变更
+}
+
+func newH2FrameConn(conn net.Conn, opts h2ConnOptions) *h2FrameConn {
+	c := &h2FrameConn{
+		Conn: conn,
+		opts: opts,
+		dec:  hpack.NewDecoder(h2HeaderTableSize, nil),
+	}
+	c.framer = http2.NewFramer(&c.out, nil)
+	c.enc = hpack.NewEncoder(&c.encBuf)
+	c.enc.SetMaxDynamicTableSizeLimit(h2HeaderTableSize)
+	c.reader.onSettings = c.onPeerSettings
+	c.pendingTableSize.Store(-1)
+	return c
+}
+
+func (c *h2FrameConn) Write(p []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	c.wbuf = append(c.wbuf, p...)
+	c.out.Reset()
+
+	if !c.prefaceDone {
+		if len(c.wbuf) < len(http2.ClientPreface) {
+			return len(p), nil
+		}
+		c.out.Write(c.wbuf[:len(http2.ClientPreface)])
+		c.wbuf = c.wbuf[len(http2.ClientPreface):]
+		c.prefaceDone = true
+	}
+
+	consumed := 0
+	for len(c.wbuf)-consumed >= h2FrameHeaderLen {
+		frame := c.wbuf[consumed:]
+		length := int(frame[0])<<16 | int(frame[1])<<8 | int(frame[2])
+		if len(frame) < h2FrameHeaderLen+length {
+			break
+		}
+		if err := c.processFrame(frame[:h2FrameHeaderLen+length]); err != nil {
+			return 0, err
+		}
+		consumed += h2FrameHeaderLen + length
+	}
+	c.wbuf = append(c.wbuf[:0], c.wbuf[consumed:]...)
+
+	if c.out.Len() > 0 {
+		if _, err := c.Conn.Write(c.out.Bytes()); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// processFrame 处理一个完整的客户端帧：HEADERS/CONTINUATION 改写，其余原样转发
+func (c *h2FrameConn) processFrame(frame []byte) error {
+	typ := http2.FrameType(frame[3])
+	flags := http2.Flags(frame[4])
+	streamID := binary.BigEndian.Uint32(frame[5:9]) & (1<<31 - 1)
+	payload := frame[h2FrameHeaderLen:]
+
+	switch typ {
+	case http2.FrameHeaders:
+		if flags.Has(http2.FlagHeadersPadded) {
+			if len(payload) < 1 || int(payload[0]) >= len(payload) {
+				return fmt.Errorf("HEADERS 帧填充长度无效")
+			}
+			payload = payload[1 : len(payload)-int(payload[0])]
+		}
+		c.pendingPriority = http2.PriorityParam{}
+		if flags.Has(http2.FlagHeadersPriority) {
+			if len(payload) < 5 {
+				return fmt.Errorf("HEADERS 帧优先级字段无效")
+			}
+			dep := binary.BigEndian.Uint32(payload[:4])
+			c.pendingPriority = http2.PriorityParam{
+				StreamDep: dep & (1<<31 - 1),
+				Exclusive: dep&(1<<31) != 0,
+				Weight:    payload[4],
+			}
+			payload = payload[5:]
+		}
+		c.pendingStreamID = streamID
+		c.pendingFlags = flags
+		c.pendingBlock = append(c.pendingBlock[:0], payload...)
+		if flags.Has(http2.FlagHeadersEndHeaders) {
+			return c.flushHeaders()
+		}
+	case http2.FrameContinuation:
+		c.pendingBlock = append(c.pendingBlock, payload...)
+		if flags.Has(http2.FlagContinuationEndHeaders) {
+			return c.flushHeaders()
+		}
+	case http2.FrameSettings:
+		if c.opts.profile == nil || c.settingsDone || flags.Has(http2.FlagSettingsAck) {
+			c.out.Write(frame)
+			return nil
+		}
+		c.settingsDone = true
+		return c.writeProfileSettings()
+	case http2.FrameWindowUpdate:
+		if c.opts.profile == nil || c.windowDone || streamID != 0 {
+			c.out.Write(frame)
+			return nil
+		}
+		c.windowDone = true
+		return c.writeProfileWindow()
+	default:
+		c.out.Write(frame)
+	}
+	return nil
+}
+
+// writeProfileSettings 以指纹中的参数与顺序替换 Transport 的初始 SETTINGS 帧
+func (c *h2FrameConn) writeProfileSettings() error {
+	settings := make([]http2.Setting, 0, len(c.opts.profile.Settings))
+	for _, s := range c.opts.profile.Settings {
+		settings = append(settings, http2.Setting{ID: http2.SettingID(s.ID), Val: s.Val})
+	}
+	return c.framer.WriteSettings(settings...)
+}
+
+// writeProfileWindow 替换 Transport 的初始连接级 WINDOW_UPDATE，并在其后发送指纹中的 PRIORITY 帧
+// Transport 的连接窗口已按指纹配置，增量与原帧一致；指纹不发送 WINDOW_UPDATE 时 Transport
+// 认为的窗口大于服务端，仍会按已消费的数据及时归还窗口
+func (c *h2FrameConn) writeProfileWindow() error {
+	profile := c.opts.profile
+	if profile.ConnectionFlow > 0 {
+		if err := c.framer.WriteWindowUpdate(0, profile.ConnectionFlow); err != nil {
+			return err
+		}
+	}
+	for _, p := range profile.Priorities {
+		if err := c.framer.WritePriority(p.StreamID, h2PriorityParam(p)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// h2PriorityParam 将指纹中的优先级（权重 1-256）转换为帧字段（权重 0-255）
+func h2PriorityParam(p fingerprint.HTTP2Priority) http2.PriorityParam {
+	return http2.PriorityParam{
+		StreamDep: p.StreamDep,
+		Exclusive: p.Exclusive,
+		Weight:    uint8(max(p.Weight, 1) - 1),
+	}
+}
+
+// flushHeaders 重排累积的头部块并重新编码写出
+func (c *h2FrameConn) flushHeaders() error {
+	fields, err := c.dec.DecodeFull(c.pendingBlock)
+	if err != nil {
+		return fmt.Errorf("解码 HTTP/2 头部失败: %w", err)
+	}
+
+	var headerOrder []string
+	kept := fields[:0]
+	for _, f := range fields {
+		if strings.EqualFold(f.Name, headerOrderKey) {
+			headerOrder = parseHeaderOrder(f.Value)
+			continue
+		}
+		kept = append(kept, f)
+	}
+	fields = orderHeaderFields(kept, c.opts.pseudoOrder, headerOrder)
+
+	if size := c.pendingTableSize.Swap(-1); size >= 0 {
+		c.enc.SetMaxDynamicTableSize(min(uint32(size), h2HeaderTableSize))
+	}
+	c.encBuf.Reset()
+	for _, f := range fields {
+		if err := c.enc.WriteField(f); err != nil {
+			return fmt.Errorf("编码 HTTP/2 头部失败: %w", err)
+		}
+	}
+
+	// 按指纹设置 HEADERS 优先级（流不能依赖自身，此时改为依赖根节点）
+	if hp := c.opts.profile; hp != nil && hp.HeaderPriority != nil {
+		c.pendingPriority = h2PriorityParam(*hp.HeaderPriority)
+		if c.pendingPriority.StreamDep == c.pendingStreamID {
+			c.pendingPriority.StreamDep = 0
+		}
+	}
+
+	block := c.encBuf.Bytes()
+	first := h2MaxFramePayload
+	if !c.pendingPriority.IsZero() {
+		first -= 5
+	}
+	chunk := block[:min(first, len(block))]
+	block = block[len(chunk):]
+	if err := c.framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      c.pendingStreamID,
+		BlockFragment: chunk,
+		EndStream:     c.pendingFlags.Has(http2.FlagHeadersEndStream),
+		EndHeaders:    len(block) == 0,
+		Priority:      c.pendingPriority,
+	}); err != nil {
+		return err
+	}
+	for len(block) > 0 {
+		chunk = block[:min(h2MaxFramePayload, len(block))]
+		block = block[len(chunk):]
+		if err := c.framer.WriteContinuation(c.pendingStreamID, len(block) == 0, chunk); err != nil {
+			return err
+		}
+	}
+	c.pendingBlock = c.pendingBlock[:0]
+	return nil
+}
+
+func (c *h2FrameConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.reader.observe(p[:n])
+	}
+	return n, err
+}
+
+// onPeerSettings 记录服务端 SETTINGS 中的 HEADER_TABLE_SIZE，在下一次编码前生效
+func (c *h2FrameConn) onPeerSettings(settings []http2.Setting) {
+	for _, s := range settings {
+		if s.ID == http2.SettingHeaderTableSize {
+			c.pendingTableSize.Store(int64(s.Val))
+		}
+	}
+}
+
+// h2FrameObserver 被动解析服务端发来的帧流（不修改数据）
+type h2FrameObserver struct {
+	header     [h2FrameHeaderLen]byte
+	headerN    int
+	remain     int
+	typ        http2.FrameType
+	flags      http2.Flags
+	payload    []byte
+	onSettings func([]http2.Setting)
+	onGoAway   func(lastStreamID uint32, code http2.ErrCode, debugData []byte)
+}
+
+// observe 消费一段读取到的数据
+func (o *h2FrameObserver) observe(p []byte) {
+	for len(p) > 0 {
+		if o.headerN < h2FrameHeaderLen {
+			k := copy(o.header[o.headerN:], p)
+			o.headerN += k
+			p = p[k:]
+			if o.headerN < h2FrameHeaderLen {
+				return
+			}
+			o.remain = int(o.header[0])<<16 | int(o.header[1])<<8 | int(o.header[2])
+			o.typ = http2.FrameType(o.header[3])
+			o.flags = http2.Flags(o.header[4])
+			o.payload = o.payload[:0]
+			if o.remain == 0 {
+				o.frameDone()
+				o.headerN = 0
+				continue
+			}
+		}
+
+		k := min(o.remain, len(p))
+		if o.wantPayload() {
+			o.payload = append(o.payload, p[:k]...)
+		}
+		o.remain -= k
+		p = p[k:]
+		if o.remain == 0 {
+			o.frameDone()
+			o.headerN = 0
+		}
+	}
+}
+
+// wantPayload 仅缓存需要解析的帧负载
+func (o *h2FrameObserver) wantPayload() bool {
+	return (o.typ == http2.FrameSettings && !o.flags.Has(http2.FlagSettingsAck)) ||
+		(o.typ == http2.FrameGoAway && o.onGoAway != nil)
+}
+
+func (o *h2FrameObserver) frameDone() {
+	if !o.wantPayload() {
+		return
+	}
+	switch o.typ {
+	case http2.FrameSettings:
+		if o.onSettings == nil {
+			return
+		}
+		var settings []http2.Setting
+		for b := o.payload; len(b) >= 6; b = b[6:] {
+			settings = append(settings, http2.Setting{
+				ID:  http2.SettingID(binary.BigEndian.Uint16(b[:2])),
+				Val: binary.BigEndian.Uint32(b[2:6]),
+			})
+		}
+		o.onSettings(settings)
+	case http2.FrameGoAway:
+		if len(o.payload) >= 8 {
+			lastStreamID := binary.BigEndian.Uint32(o.payload[:4]) & (1<<31 - 1)
+			code := http2.ErrCode(binary.BigEndian.Uint32(o.payload[4:8]))
+			o.onGoAway(lastStreamID, code, o.payload[8:])
+		}
+	}
+}
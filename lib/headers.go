@@ -0,0 +1,153 @@
+package utls_client
+
+import (
+	"net/http"
+	"strings"
+
+	utls "github.com/refraction-networking/utls"
+	"golang.org/x/net/http2/hpack"
+)
+
+// HeaderField 有序请求头中的一项（名称大小写在 HTTP/1.1 中原样发送）
+type HeaderField struct {
+	Name  string
+	Value string
+}
+
+// headerOrderKey 内部头部：携带本次请求的头部顺序，发送前由连接层按顺序重排并剥离
+// 所有传输层的拨号（含明文 http）都必须经 h1OrderConn 或 h2FrameConn 包装，否则该头部会发给服务端
+const headerOrderKey = "X-Utls-Header-Order"
+
+// pseudoHeaderOrder 返回本客户端对指定指纹使用的伪头部顺序
+// 优先级：Config.PseudoHeaderOrder > HTTP/2 指纹中的顺序；返回 nil 表示保持 Go 默认顺序
+func (c *Client) pseudoHeaderOrder(fingerprint *utls.ClientHelloID) []string {
+	if len(c.config.PseudoHeaderOrder) > 0 {
+		return c.config.PseudoHeaderOrder
+	}
+	if profile := c.http2Profile(fingerprint); profile != nil {
+		return profile.PseudoHeaderOrder
+	}
+	return nil
+}
+
+// applyRequestHeaders 将 RequestConfig 中的头部写入标准请求
+// Headers 映射先写入；OrderedHeaders 覆盖同名项，并记录发送顺序供连接层重排
+func applyRequestHeaders(httpReq *http.Request, req *RequestConfig) {
+	for k, v := range req.Headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	if len(req.OrderedHeaders) == 0 {
+		return
+	}
+
+	// 有序头部覆盖同名的映射项（忽略大小写）
+	for _, f := range req.OrderedHeaders {
+		for k := range httpReq.Header {
+			if strings.EqualFold(k, f.Name) {
+				delete(httpReq.Header, k)
+			}
+		}
+	}
+
+	// 头部按规范键存储（net/http 据此判断 User-Agent 等是否已设置），原始大小写只记录在顺序列表中，由连接层写回
+	order := make([]string, 0, len(req.OrderedHeaders))
+	seen := make(map[string]bool, len(req.OrderedHeaders))
+	for _, f := range req.OrderedHeaders {
+		name := strings.ToLower(f.Name)
+		if name == "host" {
+			httpReq.Host = f.Value
+		} else {
+			httpReq.Header.Add(f.Name, f.Value)
+		}
+		if !seen[name] {
+			seen[name] = true
+			order = append(order, f.Name)
+		}
+	}
+	httpReq.Header[headerOrderKey] = []string{strings.Join(order, ",")}
+}
+
+// requestUserAgent 返回请求将发送的 User-Agent（OrderedHeaders 覆盖 Headers，名称忽略大小写）
+func requestUserAgent(req *RequestConfig) string {
+	for _, f := range req.OrderedHeaders {
+		if strings.EqualFold(f.Name, "User-Agent") {
+			return f.Value
+		}
+	}
+	for k, v := range req.Headers {
+		if strings.EqualFold(k, "User-Agent") {
+			return v
+		}
+	}
+	return ""
+}
+
+// delHeader 删除头部（忽略大小写）
+func delHeader(header http.Header, name string) {
+	for k := range header {
+		if strings.EqualFold(k, name) {
+			delete(header, k)
+		}
+	}
+}
+
+// hasHeader 判断头部是否存在（忽略大小写）
+func hasHeader(header http.Header, name string) bool {
+	for k := range header {
+		if strings.EqualFold(k, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHeaderOrder 解析内部顺序头部的值（名称保留调用方的大小写）
+func parseHeaderOrder(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// orderHeaderFields 按伪头部顺序与普通头部顺序重排 HTTP/2 头部字段
+// 伪头部始终位于普通头部之前；未出现在顺序列表中的字段保持原有相对顺序并排在末尾
+func orderHeaderFields(fields []hpack.HeaderField, pseudoOrder, headerOrder []string) []hpack.HeaderField {
+	var pseudo, regular []hpack.HeaderField
+	for _, f := range fields {
+		if f.IsPseudo() {
+			pseudo = append(pseudo, f)
+		} else {
+			regular = append(regular, f)
+		}
+	}
+
+	out := make([]hpack.HeaderField, 0, len(fields))
+	out = append(out, orderByName(pseudo, pseudoOrder, func(f hpack.HeaderField) string { return f.Name })...)
+	out = append(out, orderByName(regular, headerOrder, func(f hpack.HeaderField) string { return f.Name })...)
+	return out
+}
+
+// orderByName 按名称列表稳定排序：列表中的名称按列表顺序在前，其余保持原顺序在后
+func orderByName[T any](items []T, order []string, nameOf func(T) string) []T {
+	if len(order) == 0 || len(items) < 2 {
+		return items
+	}
+
+	out := make([]T, 0, len(items))
+	used := make([]bool, len(items))
+	for _, name := range order {
+		for i, item := range items {
+			if !used[i] && strings.EqualFold(nameOf(item), name) {
+				used[i] = true
+				out = append(out, item)
+			}
+		}
+	}
+	for i, item := range items {
+		if !used[i] {
+			out = append(out, item)
+		}
+	}
+	return out
+}
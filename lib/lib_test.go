@@ -0,0 +1,2354 @@
+package utls_client
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	utls "github.com/refraction-networking/utls"
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+
+	"utls_client/fingerprint"
+)
+
+// TestResolveFingerprint 测试指纹优先级与 UA 推断策略
+func TestResolveFingerprint(t *testing.T) {
+	firefoxUA := "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:120.0) Gecko/20100101 Firefox/120.0"
+	uaReq := &RequestConfig{Headers: map[string]string{"User-Agent": firefoxUA}}
+
+	cases := []struct {
+		name   string
+		hello  *utls.ClientHelloID
+		policy UAFingerprintPolicy
+		req    *RequestConfig
+		want   utls.ClientHelloID
+	}{
+		{"默认策略不覆盖已指定的指纹", &utls.HelloSafari_Auto, 0, uaReq, utls.HelloSafari_Auto},
+		{"默认策略在未指定指纹时推断", nil, 0, uaReq, utls.HelloFirefox_120},
+		{"Never 忽略UA", &utls.HelloSafari_Auto, UAPolicyNever, uaReq, utls.HelloSafari_Auto},
+		{"Never 且未指定指纹时使用默认", nil, UAPolicyNever, uaReq, utls.HelloChrome_133},
+		{"有序头部中的小写UA", nil, UAPolicyWhenUnset, &RequestConfig{
+			OrderedHeaders: []HeaderField{{Name: "user-agent", Value: firefoxUA}},
+		}, utls.HelloFirefox_120},
+		{"WhenUnset 且未指定指纹时推断", nil, UAPolicyWhenUnset, uaReq, utls.HelloFirefox_120},
+		{"WhenUnset 但已指定指纹", &utls.HelloSafari_Auto, UAPolicyWhenUnset, uaReq, utls.HelloSafari_Auto},
+		{"Always 覆盖客户端指纹", &utls.HelloSafari_Auto, UAPolicyAlways, uaReq, utls.HelloFirefox_120},
+		{"请求级指纹优先", &utls.HelloSafari_Auto, UAPolicyAlways, &RequestConfig{
+			Headers:     map[string]string{"User-Agent": firefoxUA},
+			Fingerprint: &utls.HelloEdge_106,
+		}, utls.HelloEdge_106},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewClient(tc.hello, &Config{UAPolicy: tc.policy})
+			got := c.resolveFingerprint(tc.req)
+			if got != tc.want {
+				t.Fatalf("指纹 = %s, 期望 %s", got.Str(), tc.want.Str())
+			}
+		})
+	}
+}
+
+// TestClientCacheKeyByFingerprint 测试同一主机不同指纹不共享传输层
+func TestClientCacheKeyByFingerprint(t *testing.T) {
+	c := NewClient(nil, nil)
+	chrome := c.getOrCreateClient("https://example.com/", "example.com", &utls.HelloChrome_133, "", "")
+	firefox := c.getOrCreateClient("https://example.com/", "example.com", &utls.HelloFirefox_120, "", "")
+	if chrome == firefox {
+		t.Fatal("不同指纹复用了同一个 HTTP/2 客户端")
+	}
+	if again := c.getOrCreateClient("https://example.com/", "example.com", &utls.HelloChrome_133, "", ""); again != chrome {
+		t.Fatal("相同指纹未复用 HTTP/2 客户端")
+	}
+}
+
+// TestLocalIPBinding 测试请求级源地址覆盖、源地址池轮换与按源地址区分的传输层
+func TestLocalIPBinding(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		w.Write([]byte(host))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	remoteIP := func(c *Client, req *RequestConfig) string {
+		t.Helper()
+		resp, err := c.Do("GET", srv.URL, req)
+		if err != nil {
+			t.Fatalf("请求失败: %v", err)
+		}
+		return string(resp.Body)
+	}
+
+	c := NewClient(nil, &Config{Timeout: 5 * time.Second, InsecureSkipVerify: true, LocalIP: "127.0.0.2"})
+	if got := remoteIP(c, nil); got != "127.0.0.2" {
+		t.Fatalf("全局源地址 = %s, 期望 127.0.0.2", got)
+	}
+	if got := remoteIP(c, &RequestConfig{LocalIP: "127.0.0.3"}); got != "127.0.0.3" {
+		t.Fatalf("请求级源地址 = %s, 期望 127.0.0.3", got)
+	}
+	if got := remoteIP(c, nil); got != "127.0.0.2" {
+		t.Fatalf("请求级覆盖影响了后续请求: %s", got)
+	}
+	if _, err := c.Do("GET", srv.URL, &RequestConfig{LocalIP: "nope"}); err == nil {
+		t.Fatal("无效源地址未返回错误")
+	}
+
+	pool, err := NewSourcePool([]string{"127.0.0.4", "127.0.0.5"})
+	if err != nil {
+		t.Fatalf("创建源地址池失败: %v", err)
+	}
+	c = NewClient(nil, &Config{Timeout: 5 * time.Second, InsecureSkipVerify: true, SourcePool: pool})
+	for _, want := range []string{"127.0.0.4", "127.0.0.5", "127.0.0.4"} {
+		if got := remoteIP(c, nil); got != want {
+			t.Fatalf("源地址池 = %s, 期望 %s", got, want)
+		}
+	}
+	if len(c.clients) != 2 {
+		t.Fatalf("传输层数量 = %d, 期望按源地址区分为 2", len(c.clients))
+	}
+
+	pool, err = NewPrefixSourcePool("127.0.1.0/24", 0)
+	if err != nil {
+		t.Fatalf("创建网段源地址池失败: %v", err)
+	}
+	c = NewClient(nil, &Config{Timeout: 5 * time.Second, InsecureSkipVerify: true, SourcePool: pool})
+	_, prefix, _ := net.ParseCIDR("127.0.1.0/24")
+	for i := 0; i < 3; i++ {
+		if got := remoteIP(c, nil); !prefix.Contains(net.ParseIP(got)) {
+			t.Fatalf("随机源地址 %s 不在网段内", got)
+		}
+	}
+	if len(c.clients) != 0 {
+		t.Fatal("一次性随机源地址不应缓存传输层")
+	}
+}
+
+// TestProtocolNegotiation 测试按 ALPN 单次拨号选择协议、源站协议记录与强制协议
+func TestProtocolNegotiation(t *testing.T) {
+	newServer := func(h2 bool, dials *atomic.Int32) *httptest.Server {
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			w.Write(body)
+		}))
+		srv.EnableHTTP2 = h2
+		srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+			if state == http.StateNew {
+				dials.Add(1)
+			}
+		}
+		srv.StartTLS()
+		return srv
+	}
+
+	var h1Dials, h2Dials atomic.Int32
+	h1Srv := newServer(false, &h1Dials)
+	defer h1Srv.Close()
+	h2Srv := newServer(true, &h2Dials)
+	defer h2Srv.Close()
+
+	c := NewClient(nil, &Config{Timeout: 5 * time.Second, InsecureSkipVerify: true})
+	for i := 0; i < 2; i++ {
+		// 不可重放的请求体：HTTP/2 拨号协商出 http/1.1 时不能丢失
+		body := io.MultiReader(strings.NewReader("payload"))
+		resp, err := c.Do("POST", h1Srv.URL, &RequestConfig{Body: body})
+		if err != nil {
+			t.Fatalf("请求失败: %v", err)
+		}
+		if string(resp.Body) != "payload" || resp.HTTPVersion != "HTTP/1.1" {
+			t.Fatalf("响应 = %s %q", resp.HTTPVersion, resp.Body)
+		}
+	}
+	if n := h1Dials.Load(); n != 1 {
+		t.Fatalf("HTTP/1.1 源站连接数 = %d, 期望 1（不重复拨号）", n)
+	}
+	if got := c.OriginProtocol(h1Srv.URL); got != "http/1.1" {
+		t.Fatalf("源站协议 = %q, 期望 http/1.1", got)
+	}
+
+	resp, err := c.Get(h2Srv.URL, nil)
+	if err != nil || resp.HTTPVersion != "HTTP/2" {
+		t.Fatalf("HTTP/2 请求失败: %v", err)
+	}
+	if got := c.OriginProtocol(h2Srv.URL); got != "h2" {
+		t.Fatalf("源站协议 = %q, 期望 h2", got)
+	}
+
+	c = NewClient(nil, &Config{Timeout: 5 * time.Second, InsecureSkipVerify: true, Protocol: ProtocolHTTP1})
+	if resp, err := c.Get(h2Srv.URL, nil); err != nil || resp.HTTPVersion != "HTTP/1.1" {
+		t.Fatalf("强制 HTTP/1.1 失败: %v", err)
+	}
+
+	c = NewClient(nil, &Config{Timeout: 5 * time.Second, InsecureSkipVerify: true, Protocol: ProtocolHTTP2})
+	if _, err := c.Get(h1Srv.URL, nil); err == nil {
+		t.Fatal("强制 HTTP/2 访问仅支持 HTTP/1.1 的源站未返回错误")
+	}
+}
+
+// TestPlainHTTP 测试明文 http:// 请求走 HTTP/1.1，并经 Resolver、本地源地址与代理链连接
+func TestPlainHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		fmt.Fprintf(w, "%s %s", r.Proto, host)
+	}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+	for _, protocol := range []HTTPProtocol{ProtocolAuto, ProtocolHTTP2} {
+		c := NewClient(nil, &Config{Timeout: 5 * time.Second, Protocol: protocol})
+		resp, err := c.Get(srv.URL, nil)
+		if err != nil || string(resp.Body) != "HTTP/1.1 127.0.0.1" {
+			t.Fatalf("协议策略 %d: 明文请求响应 = %v, err=%v", protocol, resp, err)
+		}
+		c.Close()
+	}
+
+	// 域名经 Resolver 解析，连接绑定本地源地址
+	hosts, _ := NewHostsResolver(map[string][]string{"plain.test": {"127.0.0.1"}}, nil)
+	c := NewClient(nil, &Config{Timeout: 5 * time.Second, Resolver: hosts, LocalIP: "127.0.0.2"})
+	defer c.Close()
+	resp, err := c.Get("http://plain.test:"+port+"/", nil)
+	if err != nil || string(resp.Body) != "HTTP/1.1 127.0.0.2" {
+		t.Fatalf("经 Resolver 与本地源地址的明文请求响应 = %v, err=%v", resp, err)
+	}
+
+	// 经 CONNECT 代理
+	var connects atomic.Int32
+	connectProxy := newConnectProxy("user", "pass")
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		connects.Add(1)
+		connectProxy(w, r)
+	}))
+	defer proxy.Close()
+	c = NewClient(nil, &Config{Timeout: 5 * time.Second, Proxy: "http://user:pass@" + proxy.Listener.Addr().String()})
+	defer c.Close()
+	if resp, err := c.Get(srv.URL, nil); err != nil || !strings.HasPrefix(string(resp.Body), "HTTP/1.1") || connects.Load() != 1 {
+		t.Fatalf("经代理的明文请求响应 = %v, err=%v, CONNECT 次数 = %d", resp, err, connects.Load())
+	}
+}
+
+// TestPrefixSourcePool 测试网段内随机源地址生成
+func TestPrefixSourcePool(t *testing.T) {
+	_, prefix, _ := net.ParseCIDR("2001:db8:1:2::/64")
+	pool, err := NewPrefixSourcePool(prefix.String(), 16)
+	if err != nil {
+		t.Fatalf("创建失败: %v", err)
+	}
+	seen := make(map[string]bool)
+	for i := 0; i < 32; i++ {
+		ip, err := pool.Next()
+		if err != nil {
+			t.Fatalf("获取源地址失败: %v", err)
+		}
+		if !prefix.Contains(ip) || ip.To4() != nil {
+			t.Fatalf("源地址 %s 不在网段 %s 内", ip, prefix)
+		}
+		seen[ip.String()] = true
+	}
+	if len(seen) != 16 {
+		t.Fatalf("不同源地址数量 = %d, 期望 16", len(seen))
+	}
+
+	if _, err := NewPrefixSourcePool("10.0.0.0/30", 3); err == nil {
+		t.Fatal("网段容量不足未返回错误")
+	}
+	if _, err := NewPrefixSourcePool("10.0.0.1/32", 0); err == nil {
+		t.Fatal("网段过小未返回错误")
+	}
+}
+
+// TestBodyReaderLimit 测试响应体大小限制与进度回调
+func TestBodyReaderLimit(t *testing.T) {
+	c := NewClient(nil, &Config{MaxBodyBytes: 8})
+	newResp := func(body string, length int64) *http.Response {
+		return &http.Response{Body: io.NopCloser(strings.NewReader(body)), ContentLength: length}
+	}
+
+	// 未知长度、未超限
+	var progress int64
+	reader, err := c.newBodyReader(newResp("12345678", -1), &RequestConfig{
+		OnProgress: func(read, total int64) { progress = read },
+	})
+	if err != nil {
+		t.Fatalf("创建读取器失败: %v", err)
+	}
+	if data, err := io.ReadAll(reader); err != nil || string(data) != "12345678" {
+		t.Fatalf("读取结果 = %q, %v", data, err)
+	}
+	if progress != 8 {
+		t.Fatalf("进度 = %d, 期望 8", progress)
+	}
+
+	// 未知长度、超限
+	reader, _ = c.newBodyReader(newResp("123456789", -1), &RequestConfig{})
+	if data, err := io.ReadAll(reader); !errors.Is(err, ErrBodyTooLarge) || len(data) != 8 {
+		t.Fatalf("读取结果 = %q, %v，期望截断并返回 ErrBodyTooLarge", data, err)
+	}
+
+	// Content-Length 已知且超限，直接失败；请求级限制覆盖全局限制
+	if _, err := c.newBodyReader(newResp("123456789", 9), &RequestConfig{}); !errors.Is(err, ErrBodyTooLarge) {
+		t.Fatalf("期望 ErrBodyTooLarge，实际 %v", err)
+	}
+	if _, err := c.newBodyReader(newResp("123456789", 9), &RequestConfig{MaxBodyBytes: 16}); err != nil {
+		t.Fatalf("请求级限制未生效: %v", err)
+	}
+}
+
+// captureConn 记录写入数据的假连接
+type captureConn struct {
+	net.Conn
+	buf bytes.Buffer
+}
+
+func (c *captureConn) Write(p []byte) (int, error) { return c.buf.Write(p) }
+
+// TestAutoDecompress 测试各内容编码的自动解码与大小记录
+func TestAutoDecompress(t *testing.T) {
+	const plain = "hello, hello, hello, hello, hello, hello, hello"
+	compress := func(coding string, data []byte) []byte {
+		var buf bytes.Buffer
+		var w io.WriteCloser
+		switch coding {
+		case "gzip":
+			w = gzip.NewWriter(&buf)
+		case "deflate":
+			w = zlib.NewWriter(&buf)
+		case "raw-deflate":
+			w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+		case "br":
+			w = brotli.NewWriter(&buf)
+		case "zstd":
+			w, _ = zstd.NewWriter(&buf)
+		}
+		w.Write(data)
+		w.Close()
+		return buf.Bytes()
+	}
+
+	cases := []struct {
+		name     string
+		encoding string
+		body     []byte
+		want     string
+	}{
+		{"gzip", "gzip", compress("gzip", []byte(plain)), plain},
+		{"deflate", "deflate", compress("deflate", []byte(plain)), plain},
+		{"裸deflate", "deflate", compress("raw-deflate", []byte(plain)), plain},
+		{"br", "br", compress("br", []byte(plain)), plain},
+		{"zstd", "zstd", compress("zstd", []byte(plain)), plain},
+		{"多层编码", "gzip, br", compress("br", compress("gzip", []byte(plain))), plain},
+		{"不支持的编码", "compress", []byte("raw"), "raw"},
+	}
+
+	c := NewClient(nil, &Config{AutoDecompress: true})
+	for _, tc := range cases {
+		resp := &http.Response{
+			Header:        http.Header{"Content-Encoding": {tc.encoding}, "Content-Length": {"1"}},
+			Body:          io.NopCloser(bytes.NewReader(tc.body)),
+			ContentLength: int64(len(tc.body)),
+		}
+		reader, err := c.newBodyReader(resp, &RequestConfig{})
+		if err != nil {
+			t.Fatalf("%s: 创建读取器失败: %v", tc.name, err)
+		}
+		data, err := io.ReadAll(reader)
+		if err != nil || string(data) != tc.want {
+			t.Fatalf("%s: 读取结果 = %q, %v", tc.name, data, err)
+		}
+		if reader.encoding != tc.encoding || reader.wire.n != int64(len(tc.body)) || reader.read != int64(len(tc.want)) {
+			t.Fatalf("%s: 编码/大小记录错误: %q %d %d", tc.name, reader.encoding, reader.wire.n, reader.read)
+		}
+		decoded := tc.want == plain
+		if decoded == (resp.Header.Get("Content-Encoding") != "") {
+			t.Fatalf("%s: Content-Encoding 头部处理错误: %v", tc.name, resp.Header)
+		}
+	}
+}
+
+// TestH1HeaderOrder 测试 HTTP/1.1 请求头按顺序重排，且长连接上的后续请求同样生效
+func TestH1HeaderOrder(t *testing.T) {
+	capture := &captureConn{}
+	conn := newH1OrderConn(capture)
+
+	ordered := &RequestConfig{OrderedHeaders: []HeaderField{
+		{Name: "Host", Value: "example.com"},
+		{Name: "sec-ch-ua", Value: `"Chromium";v="133"`},
+		{Name: "User-Agent", Value: "ua"},
+		{Name: "Accept", Value: "*/*"},
+	}}
+
+	first, _ := http.NewRequest("POST", "http://example.com/a", strings.NewReader("hello"))
+	applyRequestHeaders(first, ordered)
+	second, _ := http.NewRequest("POST", "http://example.com/b", io.MultiReader(strings.NewReader("chunked-body")))
+	applyRequestHeaders(second, ordered)
+
+	if err := first.Write(conn); err != nil {
+		t.Fatalf("写入第一个请求失败: %v", err)
+	}
+	if err := second.Write(conn); err != nil {
+		t.Fatalf("写入第二个请求失败: %v", err)
+	}
+
+	out := capture.buf.String()
+	if strings.Contains(strings.ToLower(out), strings.ToLower(headerOrderKey)) {
+		t.Fatalf("内部顺序头部未被剥离:\n%s", out)
+	}
+	if !strings.Contains(out, "hello") || !strings.Contains(out, "chunked-body") {
+		t.Fatalf("请求体丢失:\n%s", out)
+	}
+
+	heads := strings.Split(out, "POST ")[1:]
+	if len(heads) != 2 {
+		t.Fatalf("期望 2 个请求，实际 %d:\n%s", len(heads), out)
+	}
+	for _, head := range heads {
+		lines := strings.Split(head, "\r\n")
+		want := []string{"Host:", "sec-ch-ua:", "User-Agent:", "Accept:"}
+		for i, prefix := range want {
+			if !strings.HasPrefix(lines[i+1], prefix) {
+				t.Fatalf("第 %d 行 = %q，期望以 %q 开头:\n%s", i+1, lines[i+1], prefix, head)
+			}
+		}
+	}
+
+	// 小写名称：User-Agent 被识别为已设置（不再追加 Go 默认 UA），名称大小写原样发送
+	capture.buf.Reset()
+	lower, _ := http.NewRequest("GET", "http://example.com/c", nil)
+	applyRequestHeaders(lower, &RequestConfig{
+		Headers: map[string]string{"User-Agent": "mapped"},
+		OrderedHeaders: []HeaderField{
+			{Name: "user-agent", Value: "ua"},
+			{Name: "accept-language", Value: "en"},
+		},
+	})
+	if err := lower.Write(newH1OrderConn(capture)); err != nil {
+		t.Fatalf("写入小写头部请求失败: %v", err)
+	}
+	out = capture.buf.String()
+	lines := strings.Split(out, "\r\n")
+	if strings.Count(strings.ToLower(out), "user-agent:") != 1 ||
+		!strings.HasPrefix(lines[1], "user-agent: ua") || !strings.HasPrefix(lines[2], "accept-language: en") {
+		t.Fatalf("小写头部应只发送一个 UA 且保持名称大小写:\n%s", out)
+	}
+}
+
+// TestHeaderOrderNotSent 测试内部顺序头部在所有连接路径上都被剥离，服务端不会收到
+func TestHeaderOrderNotSent(t *testing.T) {
+	var leaked atomic.Int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Header[headerOrderKey]; ok {
+			leaked.Add(1)
+		}
+		w.Write([]byte(r.Header.Get("Accept")))
+	})
+	newServer := func(h2, tls bool) *httptest.Server {
+		srv := httptest.NewUnstartedServer(handler)
+		srv.EnableHTTP2 = h2
+		if tls {
+			srv.StartTLS()
+		} else {
+			srv.Start()
+		}
+		return srv
+	}
+	h1Srv, h2Srv, plain := newServer(false, true), newServer(true, true), newServer(false, false)
+	defer h1Srv.Close()
+	defer h2Srv.Close()
+	defer plain.Close()
+
+	req := &RequestConfig{OrderedHeaders: []HeaderField{{Name: "Accept", Value: "*/*"}}}
+	for _, protocol := range []HTTPProtocol{ProtocolAuto, ProtocolHTTP1} {
+		c := NewClient(nil, &Config{Timeout: 5 * time.Second, InsecureSkipVerify: true, Protocol: protocol})
+		for _, target := range []string{h1Srv.URL, h2Srv.URL, plain.URL} {
+			resp, err := c.Do(http.MethodGet, target, req)
+			if err != nil || string(resp.Body) != "*/*" {
+				t.Fatalf("协议策略 %d 请求 %s: 响应 = %v, err=%v", protocol, target, resp, err)
+			}
+		}
+		c.Close()
+	}
+
+	m := NewConnPoolManager(utls.HelloChrome_133, &Config{Timeout: 5 * time.Second, InsecureSkipVerify: true})
+	defer m.Close()
+	if _, err := m.Do(context.Background(), h2Srv.Listener.Addr().String(), &RequestConfig{
+		Path: "/", OrderedHeaders: req.OrderedHeaders,
+	}); err != nil {
+		t.Fatalf("连接池请求失败: %v", err)
+	}
+
+	if n := leaked.Load(); n != 0 {
+		t.Fatalf("服务端收到内部顺序头部 %d 次", n)
+	}
+}
+
+// TestH2HeaderOrder 测试 HTTP/2 伪头部与普通头部按指纹顺序重排
+func TestH2HeaderOrder(t *testing.T) {
+	// 使用真实的回环连接（net.Pipe 无缓冲，双向同时写会死锁）
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	defer ln.Close()
+
+	received := make(chan []hpack.HeaderField, 1)
+	go func() {
+		serverConn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer serverConn.Close()
+		serveH2Once(serverConn, received)
+	}()
+
+	clientConn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("连接失败: %v", err)
+	}
+	defer clientConn.Close()
+
+	cc, err := new(http2.Transport).NewClientConn(newH2FrameConn(clientConn, h2ConnOptions{pseudoOrder: fingerprint.HTTP2Chrome117.PseudoHeaderOrder}))
+	if err != nil {
+		t.Fatalf("创建 HTTP/2 连接失败: %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "https://example.com/path", nil)
+	applyRequestHeaders(req, &RequestConfig{
+		Headers: map[string]string{"X-Extra": "1"},
+		OrderedHeaders: []HeaderField{
+			{Name: "User-Agent", Value: "ua"},
+			{Name: "Accept", Value: "*/*"},
+			{Name: "Accept-Language", Value: "en"},
+		},
+	})
+	resp, err := cc.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	resp.Body.Close()
+
+	fields := <-received
+	var names []string
+	for _, f := range fields {
+		names = append(names, f.Name)
+	}
+	got := strings.Join(names, ",")
+	want := ":method,:authority,:scheme,:path,user-agent,accept,accept-language,"
+	if !strings.HasPrefix(got, want) {
+		t.Fatalf("头部顺序 = %s，期望前缀 %s", got, want)
+	}
+	if strings.Contains(got, strings.ToLower(headerOrderKey)) {
+		t.Fatalf("内部顺序头部未被剥离: %s", got)
+	}
+}
+
+// TestH2ProfilePreface 测试按 HTTP/2 指纹改写连接前言与 HEADERS 优先级
+func TestH2ProfilePreface(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	defer ln.Close()
+
+	frames := make(chan []string, 1)
+	go func() {
+		serverConn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer serverConn.Close()
+
+		preface := make([]byte, len(http2.ClientPreface))
+		if _, err := io.ReadFull(serverConn, preface); err != nil {
+			return
+		}
+		framer := http2.NewFramer(serverConn, serverConn)
+		framer.WriteSettings()
+		var got []string
+		for {
+			frame, err := framer.ReadFrame()
+			if err != nil {
+				return
+			}
+			switch f := frame.(type) {
+			case *http2.SettingsFrame:
+				if f.IsAck() {
+					continue
+				}
+				var settings []string
+				f.ForeachSetting(func(s http2.Setting) error {
+					settings = append(settings, fmt.Sprintf("%d:%d", s.ID, s.Val))
+					return nil
+				})
+				got = append(got, "SETTINGS "+strings.Join(settings, ";"))
+				framer.WriteSettingsAck()
+			case *http2.WindowUpdateFrame:
+				got = append(got, fmt.Sprintf("WINDOW_UPDATE %d", f.Increment))
+			case *http2.PriorityFrame:
+				got = append(got, fmt.Sprintf("PRIORITY %d:%d:%d", f.StreamID, f.StreamDep, f.Weight))
+			case *http2.HeadersFrame:
+				got = append(got, fmt.Sprintf("HEADERS %d:%d:%d", f.StreamID, f.Priority.StreamDep, f.Priority.Weight))
+				frames <- got
+				return
+			}
+		}
+	}()
+
+	clientConn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("连接失败: %v", err)
+	}
+	defer clientConn.Close()
+
+	profile := fingerprint.HTTP2Firefox
+	transport := newHTTP2Transport(profile, false)
+	cc, err := transport.NewClientConn(newH2FrameConn(clientConn, h2ConnOptions{profile: profile}))
+	if err != nil {
+		t.Fatalf("创建 HTTP/2 连接失败: %v", err)
+	}
+	req, _ := http.NewRequest("GET", "https://example.com/", nil)
+	go cc.RoundTrip(req)
+
+	want := []string{
+		"SETTINGS 1:65536;4:131072;5:16384",
+		"WINDOW_UPDATE 12517377",
+		"PRIORITY 3:0:200",
+		"PRIORITY 5:0:100",
+		"PRIORITY 7:0:0",
+		"PRIORITY 9:7:0",
+		"PRIORITY 11:3:0",
+		"PRIORITY 13:0:240",
+		"HEADERS 1:13:41",
+	}
+	if got := <-frames; strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("连接前言 = %q，期望 %q", got, want)
+	}
+}
+
+// TestCustomSpecHandshake 测试使用注册的自定义 ClientHelloSpec 完成握手
+func TestCustomSpecHandshake(t *testing.T) {
+	profiles, err := fingerprint.LoadProfiles("../fingerprint/profiles/chrome_133.yaml")
+	if err != nil {
+		t.Fatalf("加载指纹失败: %v", err)
+	}
+	profile := profiles[0]
+	if err := fingerprint.RegisterProfile(profile); err != nil {
+		t.Fatalf("注册指纹失败: %v", err)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	c := NewClient(&profile.HelloID, &Config{Timeout: 5 * time.Second, InsecureSkipVerify: true})
+	resp, err := c.Get(srv.URL, nil)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	if string(resp.Body) != "ok" || resp.HTTPVersion != "HTTP/2" {
+		t.Fatalf("响应 = %s %q", resp.HTTPVersion, resp.Body)
+	}
+}
+
+// TestEchoFingerprint 测试客户端实际发送的 TLS 与 HTTP/2 指纹与分析结果一致
+func TestEchoFingerprint(t *testing.T) {
+	server, err := fingerprint.NewEchoServer()
+	if err != nil {
+		t.Fatalf("启动回显服务器失败: %v", err)
+	}
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Addr())
+
+	for _, helloID := range []utls.ClientHelloID{utls.HelloChrome_133, utls.HelloFirefox_120, utls.HelloSafari_Auto} {
+		profile := fingerprint.FingerprintProfile{HelloID: helloID, HTTP2: fingerprint.HTTP2ProfileFor(helloID)}
+		want, err := fingerprint.AnalyzeProfile(profile)
+		if err != nil {
+			t.Fatalf("%s: 分析失败: %v", helloID.Str(), err)
+		}
+
+		c := NewClient(&helloID, &Config{Timeout: 5 * time.Second, InsecureSkipVerify: true})
+		resp, err := c.Get("https://localhost:"+port+"/", nil)
+		if err != nil {
+			t.Fatalf("%s: 请求失败: %v", helloID.Str(), err)
+		}
+		var got fingerprint.EchoReport
+		if err := json.Unmarshal(resp.Body, &got); err != nil {
+			t.Fatalf("%s: 解析回显失败: %v", helloID.Str(), err)
+		}
+		if got.JA4 != want.JA4 || got.JA3N != want.JA3N {
+			t.Fatalf("%s: JA4 = %s, 期望 %s", helloID.Str(), got.JA4, want.JA4)
+		}
+		if got.Akamai != want.Akamai {
+			t.Fatalf("%s: Akamai = %s, 期望 %s", helloID.Str(), got.Akamai, want.Akamai)
+		}
+	}
+}
+
+// TestAuthenticatedProxies 测试 CONNECT Basic 认证、HTTPS 代理与 SOCKS5 用户名/密码认证
+func TestAuthenticatedProxies(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer target.Close()
+	_, port, _ := net.SplitHostPort(target.Listener.Addr().String())
+	targetURL := "https://localhost:" + port + "/"
+
+	get := func(proxy string) error {
+		c := NewClient(nil, &Config{Timeout: 5 * time.Second, InsecureSkipVerify: true, Proxy: proxy})
+		resp, err := c.Get(targetURL, nil)
+		if err == nil && string(resp.Body) != "ok" {
+			err = fmt.Errorf("响应 = %q", resp.Body)
+		}
+		return err
+	}
+
+	connectProxy := newConnectProxy("user", "p@ss")
+	plain := httptest.NewServer(connectProxy)
+	defer plain.Close()
+	secure := httptest.NewTLSServer(connectProxy)
+	defer secure.Close()
+
+	if err := get("http://user:p%40ss@" + plain.Listener.Addr().String()); err != nil {
+		t.Fatalf("CONNECT 认证失败: %v", err)
+	}
+	var authErr *ProxyAuthRequiredError
+	if err := get("http://" + plain.Listener.Addr().String()); !errors.As(err, &authErr) {
+		t.Fatalf("缺少代理认证应返回 ProxyAuthRequiredError，实际 %v", err)
+	}
+	if err := get("https://user:p%40ss@" + secure.Listener.Addr().String()); err != nil {
+		t.Fatalf("HTTPS 代理失败: %v", err)
+	}
+
+	socks := newSOCKS5Proxy(t, "user", "secret")
+	defer socks.Close()
+	if err := get("socks5h://user:secret@" + socks.Addr().String()); err != nil {
+		t.Fatalf("socks5h 失败: %v", err)
+	}
+	if got := <-socks.addrTypes; got != 0x03 {
+		t.Fatalf("socks5h 地址类型 = %d, 期望域名", got)
+	}
+	if err := get("socks5://user:secret@" + socks.Addr().String()); err != nil {
+		t.Fatalf("socks5 失败: %v", err)
+	}
+	if got := <-socks.addrTypes; got != 0x01 && got != 0x04 {
+		t.Fatalf("socks5 地址类型 = %d, 期望本地解析后的 IP", got)
+	}
+	if err := get("socks5://user:wrong@" + socks.Addr().String()); !errors.As(err, &authErr) {
+		t.Fatalf("SOCKS5 密码错误应返回 ProxyAuthRequiredError，实际 %v", err)
+	}
+}
+
+// TestProxyHandshakeParsing 测试分片到达的代理响应、响应头之后的数据交付与类型化错误
+func TestProxyHandshakeParsing(t *testing.T) {
+	// proxyConn 模拟代理：丢弃请求并分片写入响应
+	proxyConn := func(chunks ...string) net.Conn {
+		client, server := net.Pipe()
+		go io.Copy(io.Discard, server)
+		go func() {
+			for _, chunk := range chunks {
+				if _, err := server.Write([]byte(chunk)); err != nil {
+					return
+				}
+			}
+			server.Close()
+		}()
+		return client
+	}
+
+	conn, err := httpConnectProxy(proxyConn("HTTP/1.1 200 Connection established\r\n", "Via: 1.1 proxy\r\n\r\nhello"), "proxy:8080", "example.com:443", nil)
+	if err != nil {
+		t.Fatalf("CONNECT 失败: %v", err)
+	}
+	got, _ := io.ReadAll(conn)
+	if string(got) != "hello" {
+		t.Fatalf("响应头之后的数据 = %q, 期望 hello", got)
+	}
+
+	_, err = httpConnectProxy(proxyConn("HTTP/1.1 403 Forbidden\r\nServer: nginx/1.20.0\r\n\r\n"), "proxy:8080", "example.com:443", nil)
+	var refused *ProxyRefusedError
+	if !errors.As(err, &refused) || refused.StatusCode != http.StatusForbidden {
+		t.Fatalf("期望 ProxyRefusedError 403，实际 %v", err)
+	}
+
+	_, err = httpConnectProxy(proxyConn("HTTP/1.1 407 Proxy Authentication Required\r\nProxy-Authenticate: Basic realm=\"p\"\r\n\r\n"), "proxy:8080", "example.com:443", nil)
+	var authErr *ProxyAuthRequiredError
+	if !errors.As(err, &authErr) || len(authErr.Authenticate) != 1 {
+		t.Fatalf("期望 ProxyAuthRequiredError，实际 %v", err)
+	}
+
+	// SOCKS5：方法选择与应答分片到达，应答码为 connection refused
+	_, err = socks5Connect(proxyConn("\x05", "\x00", "\x05\x05", "\x00\x01\x00\x00\x00\x00\x00\x00"), "proxy:1080", "example.com:443", nil)
+	var socksErr *SOCKS5Error
+	if !errors.As(err, &socksErr) || socksErr.Code != SOCKS5ConnectionRefused || socksErr.Name() != "connection refused" {
+		t.Fatalf("期望 SOCKS5Error connection refused，实际 %v", err)
+	}
+
+	// SOCKS5：应答被截断
+	_, err = socks5Connect(proxyConn("\x05\x00", "\x05\x00\x00\x01\x7f"), "proxy:1080", "example.com:443", nil)
+	if err == nil {
+		t.Fatal("截断的 SOCKS5 应答未返回错误")
+	}
+}
+
+// blockingResolver 解析一直阻塞到 ctx 结束
+type blockingResolver struct{}
+
+func (blockingResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// TestContextCancellation 测试 ctx 取消或超时能及时中止拨号、代理握手与 TLS 握手
+func TestContextCancellation(t *testing.T) {
+	// 接受连接并读取请求但从不应答，握手停在等待对端
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+	silent := ln.Addr().String()
+
+	cases := []struct {
+		name   string
+		config Config
+		target string
+	}{
+		{"拨号", Config{Resolver: blockingResolver{}}, "https://blocked.test/"},
+		{"HTTP CONNECT 握手", Config{Proxy: "http://" + silent}, "https://192.0.2.1/"},
+		{"SOCKS5 握手", Config{Proxy: "socks5://" + silent}, "https://192.0.2.1/"},
+		{"TLS 握手", Config{}, "https://" + silent + "/"},
+	}
+	for _, tc := range cases {
+		config := tc.config
+		config.Timeout = 30 * time.Second
+		c := NewClient(nil, &config)
+
+		// 调用方取消
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(100*time.Millisecond, cancel)
+		start := time.Now()
+		_, err := c.DoContext(ctx, http.MethodGet, tc.target, nil)
+		if elapsed := time.Since(start); !errors.Is(err, context.Canceled) || elapsed > 2*time.Second {
+			t.Fatalf("%s: 取消后应及时返回 context.Canceled，实际耗时 %v, err=%v", tc.name, elapsed, err)
+		}
+
+		// 截止时间到达
+		ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+		start = time.Now()
+		_, err = c.DoContext(ctx, http.MethodGet, tc.target, nil)
+		cancel()
+		if elapsed := time.Since(start); !errors.Is(err, context.DeadlineExceeded) || elapsed > 2*time.Second {
+			t.Fatalf("%s: 超时后应及时返回 context.DeadlineExceeded，实际耗时 %v, err=%v", tc.name, elapsed, err)
+		}
+		c.Close()
+	}
+}
+
+// TestProxyChain 测试 SOCKS5 跳板 → HTTP CONNECT 出口 → 目标的代理链
+func TestProxyChain(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer target.Close()
+	_, port, _ := net.SplitHostPort(target.Listener.Addr().String())
+
+	var connects atomic.Int32
+	connectProxy := newConnectProxy("user", "pass")
+	exit := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		connects.Add(1)
+		connectProxy(w, r)
+	}))
+	defer exit.Close()
+	socks := newSOCKS5Proxy(t, "jump", "secret")
+	defer socks.Close()
+
+	chain := "socks5h://jump:secret@" + socks.Addr().String() + ", http://user:pass@" + exit.Listener.Addr().String()
+	c := NewClient(nil, &Config{Timeout: 5 * time.Second, InsecureSkipVerify: true, Proxy: chain})
+	resp, err := c.Get("https://localhost:"+port+"/", nil)
+	if err != nil {
+		t.Fatalf("代理链请求失败: %v", err)
+	}
+	if string(resp.Body) != "ok" {
+		t.Fatalf("响应 = %q", resp.Body)
+	}
+	if connects.Load() != 1 {
+		t.Fatalf("出口代理收到 %d 个 CONNECT, 期望 1", connects.Load())
+	}
+	if len(socks.addrTypes) != 1 {
+		t.Fatalf("跳板收到 %d 个请求, 期望 1", len(socks.addrTypes))
+	}
+
+	if _, err := ParseProxyChain("ftp://proxy:21"); err == nil {
+		t.Fatal("不支持的代理协议未返回错误")
+	}
+}
+
+// TestProxyPool 测试代理池轮换策略、故障暂停与列表文件加载
+func TestProxyPool(t *testing.T) {
+	ctx := context.Background()
+	proxies := []string{"http://a:8080", "socks5://b:1080", "http://user:pass@c:3128"}
+
+	pool, err := NewProxyPool(proxies, ProxyPoolOptions{})
+	if err != nil {
+		t.Fatalf("创建代理池失败: %v", err)
+	}
+	for i := 0; i < 6; i++ {
+		chain, _ := pool.Proxy(ctx, "example.com:443", "")
+		if want := proxyAddr(pool.entries[i%3].chain[0]); proxyAddr(chain[0]) != want {
+			t.Fatalf("第 %d 次轮换 = %s, 期望 %s", i, proxyAddr(chain[0]), want)
+		}
+	}
+
+	sticky, _ := NewProxyPool(proxies, ProxyPoolOptions{Strategy: ProxyStickySession})
+	first, _ := sticky.Proxy(ctx, "a.com:443", "session-1")
+	for _, target := range []string{"b.com:443", "c.com:443"} {
+		if chain, _ := sticky.Proxy(ctx, target, "session-1"); chain.String() != first.String() {
+			t.Fatalf("同一会话切换了代理: %s -> %s", first, chain)
+		}
+	}
+	byHost, _ := NewProxyPool(proxies, ProxyPoolOptions{Strategy: ProxyStickyHost})
+	first, _ = byHost.Proxy(ctx, "example.com:443", "")
+	if chain, _ := byHost.Proxy(ctx, "example.com:8443", "x"); chain.String() != first.String() {
+		t.Fatalf("同一主机切换了代理: %s -> %s", first, chain)
+	}
+
+	// 连续失败达到阈值后暂停，冷却结束后恢复
+	flaky, _ := NewProxyPool(proxies[:2], ProxyPoolOptions{MaxFailures: 2, Cooldown: 50 * time.Millisecond})
+	bad := flaky.entries[0].chain
+	flaky.Report(bad, errors.New("拒绝连接"))
+	flaky.Report(bad, errors.New("拒绝连接"))
+	for i := 0; i < 4; i++ {
+		if chain, _ := flaky.Proxy(ctx, "example.com:443", ""); chain.String() == bad.String() {
+			t.Fatal("暂停中的代理仍被选中")
+		}
+	}
+	if status := flaky.Status()[0]; status.Healthy || status.Failures != 2 || status.LastError != "拒绝连接" {
+		t.Fatalf("代理状态 = %+v", status)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if !flaky.Status()[0].Healthy {
+		t.Fatal("冷却结束后代理未恢复")
+	}
+
+	path := filepath.Join(t.TempDir(), "proxies.txt")
+	os.WriteFile(path, []byte("# 出口代理\nhttp://a:8080\n\n  socks5h://b:1080  \nhttp://a:8080\n"), 0o600)
+	loaded, err := LoadProxyPool(path, ProxyPoolOptions{})
+	if err != nil {
+		t.Fatalf("加载代理列表失败: %v", err)
+	}
+	if len(loaded.Status()) != 2 || loaded.Status()[1].Proxy != "socks5h://b:1080" {
+		t.Fatalf("代理列表 = %+v", loaded.Status())
+	}
+}
+
+// TestResolvers 测试静态 hosts、DoH 与 DoT 解析：连接解析出的 IP，SNI 与 Host 保持原域名
+func TestResolvers(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s|%s", r.TLS.ServerName, r.Host)
+	}))
+	defer target.Close()
+	_, port, _ := net.SplitHostPort(target.Listener.Addr().String())
+
+	check := func(resolver Resolver, host string) {
+		t.Helper()
+		c := NewClient(nil, &Config{Timeout: 5 * time.Second, InsecureSkipVerify: true, Resolver: resolver})
+		defer c.Close()
+		resp, err := c.Get("https://"+host+":"+port+"/", nil)
+		if err != nil {
+			t.Fatalf("%s 请求失败: %v", host, err)
+		}
+		if want := host + "|" + host + ":" + port; string(resp.Body) != want {
+			t.Fatalf("SNI|Host = %q, 期望 %q", resp.Body, want)
+		}
+	}
+
+	hosts, err := NewHostsResolver(map[string][]string{"Pinned.Test": {"127.0.0.1"}}, nil)
+	if err != nil {
+		t.Fatalf("创建 hosts 解析器失败: %v", err)
+	}
+	check(hosts, "pinned.test")
+	if _, err := NewHostsResolver(map[string][]string{"bad.test": {"not-an-ip"}}, nil); err == nil {
+		t.Fatal("无效的 hosts 地址未返回错误")
+	}
+
+	var dohQueries atomic.Int32
+	doh := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dohQueries.Add(1)
+		query, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		if err != nil || r.Header.Get("Accept") != "application/dns-message" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(dnsTestAnswer(query))
+	}))
+	defer doh.Close()
+	dohClient := NewClient(nil, &Config{Timeout: 5 * time.Second, InsecureSkipVerify: true})
+	defer dohClient.Close()
+	dohResolver := NewDoHResolver(doh.URL+"/dns-query", dohClient)
+	check(dohResolver, "doh.test")
+	// A 与 AAAA 各一次查询，之后命中缓存
+	if _, err := dohResolver.LookupHost(context.Background(), "doh.test"); err != nil || dohQueries.Load() != 2 {
+		t.Fatalf("DoH 缓存未生效: 查询 %d 次, err=%v", dohQueries.Load(), err)
+	}
+
+	// DoT 服务端复用 httptest 的自签名证书
+	dot, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: doh.TLS.Certificates})
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	defer dot.Close()
+	go func() {
+		for {
+			conn, err := dot.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var length [2]byte
+				for {
+					if _, err := io.ReadFull(conn, length[:]); err != nil {
+						return
+					}
+					query := make([]byte, int(length[0])<<8|int(length[1]))
+					if _, err := io.ReadFull(conn, query); err != nil {
+						return
+					}
+					answer := dnsTestAnswer(query)
+					conn.Write(append([]byte{byte(len(answer) >> 8), byte(len(answer))}, answer...))
+				}
+			}()
+		}
+	}()
+	check(NewDoTResolver(dot.Addr().String(), &tls.Config{InsecureSkipVerify: true}), "dot.test")
+}
+
+// TestHappyEyeballs 测试 IPv6/IPv4 竞速、错开时间、地址族健康状态与响应中记录的对端地址
+func TestHappyEyeballs(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	// IPv6 地址模拟不通的隧道：连接一直挂起直到被取消
+	dialer := &net.Dialer{ControlContext: func(ctx context.Context, network, address string, _ syscall.RawConn) error {
+		if strings.HasPrefix(address, "[") {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	}}
+	const delay = 50 * time.Millisecond
+	c := NewClient(nil, &Config{Timeout: 5 * time.Second, DialMode: DialHappyEyeballs, HappyEyeballsDelay: delay})
+
+	race := func() time.Duration {
+		start := time.Now()
+		conn, err := c.dialHappyEyeballs(context.Background(), dialer, "tcp", port, []string{"127.0.0.1", "::1"})
+		if err != nil {
+			t.Fatalf("竞速连接失败: %v", err)
+		}
+		conn.Close()
+		if host, _, _ := net.SplitHostPort(conn.RemoteAddr().String()); host != "127.0.0.1" {
+			t.Fatalf("胜出地址 = %s, 期望 127.0.0.1", host)
+		}
+		return time.Since(start)
+	}
+
+	// IPv6 优先，挂起后等待错开时间再尝试 IPv4
+	for i := 0; i < familyMaxFailures; i++ {
+		if elapsed := race(); elapsed < delay || elapsed > time.Second {
+			t.Fatalf("第 %d 次竞速耗时 %v, 期望略大于 %v", i, elapsed, delay)
+		}
+	}
+	health := c.FamilyHealth()
+	if len(health) != 2 || health[0].Family != FamilyIPv6 || health[0].Healthy || health[0].Failures != familyMaxFailures ||
+		health[1].Family != FamilyIPv4 || health[1].Successes != familyMaxFailures {
+		t.Fatalf("地址族健康状态 = %+v", health)
+	}
+	// IPv6 不健康后 IPv4 优先，不再等待
+	if elapsed := race(); elapsed >= delay {
+		t.Fatalf("IPv6 不健康后仍等待了 %v", elapsed)
+	}
+
+	// 经客户端请求时响应记录胜出的地址与地址族
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer target.Close()
+	_, targetPort, _ := net.SplitHostPort(target.Listener.Addr().String())
+	hosts, _ := NewHostsResolver(map[string][]string{"dual.test": {"127.0.0.1"}}, nil)
+	c = NewClient(nil, &Config{Timeout: 5 * time.Second, InsecureSkipVerify: true, Resolver: hosts, DialMode: DialHappyEyeballs})
+	defer c.Close()
+	resp, err := c.Get("https://dual.test:"+targetPort+"/", nil)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	if resp.RemoteAddr != "127.0.0.1:"+targetPort || resp.AddressFamily != FamilyIPv4 {
+		t.Fatalf("对端 = %s (%s)", resp.RemoteAddr, resp.AddressFamily)
+	}
+}
+
+// TestCookieJar 测试 HTTP/2 与 HTTP/1.1 共用 Cookie、按会话隔离以及 JSON/Netscape 文件的保存与加载
+func TestCookieJar(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/consent" {
+			http.SetCookie(w, &http.Cookie{Name: "consent", Value: r.URL.Query().Get("v"), Path: "/", HttpOnly: true, MaxAge: 3600})
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "s1"})
+			return
+		}
+		cookie, err := r.Cookie("consent")
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprintf(w, "%s|%s", cookie.Value, r.Proto)
+	})
+	newServer := func(h2 bool) *httptest.Server {
+		srv := httptest.NewUnstartedServer(handler)
+		srv.EnableHTTP2 = h2
+		srv.StartTLS()
+		return srv
+	}
+	h2Srv, h1Srv := newServer(true), newServer(false)
+	defer h2Srv.Close()
+	defer h1Srv.Close()
+	// Cookie 不区分端口，两个服务器同属 localhost
+	localURL := func(srv *httptest.Server, path string) string {
+		_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+		return "https://localhost:" + port + path
+	}
+
+	jar := NewCookieJar()
+	c := NewClient(nil, &Config{Timeout: 5 * time.Second, InsecureSkipVerify: true, Jar: jar})
+	defer c.Close()
+	if _, err := c.Get(localURL(h2Srv, "/consent?v=yes"), nil); err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	for _, tc := range []struct {
+		srv  *httptest.Server
+		want string
+	}{{h2Srv, "yes|HTTP/2.0"}, {h1Srv, "yes|HTTP/1.1"}} {
+		resp, err := c.Get(localURL(tc.srv, "/"), nil)
+		if err != nil {
+			t.Fatalf("请求失败: %v", err)
+		}
+		if string(resp.Body) != tc.want {
+			t.Fatalf("响应 = %d %q, 期望 %q", resp.StatusCode, resp.Body, tc.want)
+		}
+	}
+
+	// 按会话隔离
+	jars := NewCookieJars()
+	c = NewClient(nil, &Config{Timeout: 5 * time.Second, InsecureSkipVerify: true, CookieJars: jars})
+	defer c.Close()
+	if _, err := c.Do("GET", localURL(h2Srv, "/consent?v=alice"), &RequestConfig{CookieSession: "alice"}); err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	for session, want := range map[string]int{"alice": http.StatusOK, "bob": http.StatusForbidden} {
+		resp, err := c.Do("GET", localURL(h2Srv, "/"), &RequestConfig{CookieSession: session})
+		if err != nil || resp.StatusCode != want {
+			t.Fatalf("会话 %s 状态码 = %v (%v), 期望 %d", session, resp, err, want)
+		}
+	}
+
+	// 保存后在新的容器中恢复（含会话 Cookie 与 HttpOnly 属性）
+	dir := t.TempDir()
+	u, _ := url.Parse(localURL(h1Srv, "/"))
+	for _, format := range []CookieFileFormat{CookieFormatJSON, CookieFormatNetscape} {
+		path := filepath.Join(dir, fmt.Sprintf("cookies-%d", format))
+		if err := jar.Save(path, format); err != nil {
+			t.Fatalf("保存失败: %v", err)
+		}
+		loaded, err := LoadCookieJar(path)
+		if err != nil {
+			t.Fatalf("加载失败: %v", err)
+		}
+		if got, want := fmt.Sprint(loaded.Cookies(u)), fmt.Sprint(jar.Cookies(u)); got != want {
+			t.Fatalf("格式 %d 恢复的 Cookie = %s, 期望 %s", format, got, want)
+		}
+		all := loaded.AllCookies()
+		if len(all) != 2 || all[0].Name != "consent" || !all[0].HttpOnly || all[0].Expires.IsZero() || !all[1].Expires.IsZero() {
+			t.Fatalf("格式 %d 恢复的 Cookie 属性 = %+v", format, all)
+		}
+	}
+
+	if err := jars.SaveDir(filepath.Join(dir, "sessions"), CookieFormatNetscape); err != nil {
+		t.Fatalf("保存会话失败: %v", err)
+	}
+	restored := NewCookieJars()
+	if err := restored.LoadDir(filepath.Join(dir, "sessions")); err != nil {
+		t.Fatalf("加载会话失败: %v", err)
+	}
+	if got := restored.Jar("alice").Cookies(u); len(got) != 2 {
+		t.Fatalf("恢复的会话 Cookie = %v", got)
+	}
+}
+
+// TestRedirectPolicy 测试跨主机重定向按每一跳的主机发送 SNI、方法与请求体处理、重定向链与策略
+func TestRedirectPolicy(t *testing.T) {
+	var bURL string
+	a := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/start":
+			http.Redirect(w, r, bURL+"/final", http.StatusFound)
+		case "/post":
+			http.Redirect(w, r, "/echo", http.StatusTemporaryRedirect)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/echo":
+			body, _ := io.ReadAll(r.Body)
+			fmt.Fprintf(w, "%s %s", r.Method, body)
+		case "/same":
+			http.Redirect(w, r, "/sni", http.StatusFound)
+		case "/sni":
+			fmt.Fprint(w, r.TLS.ServerName)
+		}
+	}))
+	defer a.Close()
+	b := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s|%s|auth=%q|%s", r.TLS.ServerName, r.Host, r.Header.Get("Authorization"), r.Referer())
+	}))
+	defer b.Close()
+	origin := func(host string, srv *httptest.Server) string {
+		_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+		return "https://" + host + ":" + port
+	}
+	aURL := origin("a.test", a)
+	bURL = origin("b.test", b)
+
+	hosts, _ := NewHostsResolver(map[string][]string{"a.test": {"127.0.0.1"}, "b.test": {"127.0.0.1"}}, nil)
+	newClient := func(policy RedirectPolicy, maxRedirects int) *Client {
+		return NewClient(nil, &Config{Timeout: 5 * time.Second, InsecureSkipVerify: true, Resolver: hosts,
+			RedirectPolicy: policy, MaxRedirects: maxRedirects})
+	}
+
+	c := newClient(RedirectFollow, 0)
+	defer c.Close()
+	resp, err := c.Get(aURL+"/start", map[string]string{"Authorization": "Bearer secret"})
+	if err != nil {
+		t.Fatalf("跨主机重定向失败: %v", err)
+	}
+	if want := fmt.Sprintf("b.test|%s|auth=\"\"|%s/start", strings.TrimPrefix(bURL, "https://"), aURL); string(resp.Body) != want {
+		t.Fatalf("响应 = %q, 期望 %q", resp.Body, want)
+	}
+	if resp.URL != bURL+"/final" || len(resp.Redirects) != 1 ||
+		resp.Redirects[0] != (Redirect{URL: aURL + "/start", StatusCode: http.StatusFound, Location: bURL + "/final"}) {
+		t.Fatalf("最终 URL = %s, 重定向链 = %+v", resp.URL, resp.Redirects)
+	}
+
+	// 307 保留方法并重放请求体
+	resp, err = c.Post(aURL+"/post", nil, strings.NewReader("payload"))
+	if err != nil || string(resp.Body) != "POST payload" {
+		t.Fatalf("307 重定向响应 = %v, err=%v", resp, err)
+	}
+
+	if _, err := newClient(RedirectFollow, 3).Get(aURL+"/loop", nil); !errors.Is(err, ErrTooManyRedirects) {
+		t.Fatalf("循环重定向应返回 ErrTooManyRedirects，实际 %v", err)
+	}
+
+	// Config.ServerName 只用于原始请求的主机：同主机的跳保持配置的 SNI，跨主机的跳使用目标主机名
+	fronted := NewClient(nil, &Config{Timeout: 5 * time.Second, InsecureSkipVerify: true, Resolver: hosts, ServerName: "front.test"})
+	defer fronted.Close()
+	resp, err = fronted.Get(aURL+"/same", nil)
+	if err != nil || string(resp.Body) != "front.test" {
+		t.Fatalf("同主机重定向的 SNI = %v, err=%v，期望 front.test", resp, err)
+	}
+	resp, err = fronted.Get(aURL+"/start", nil)
+	if err != nil {
+		t.Fatalf("配置 ServerName 时跨主机重定向失败: %v", err)
+	}
+	if sni, _, _ := strings.Cut(string(resp.Body), "|"); sni != "b.test" {
+		t.Fatalf("跨主机重定向的 SNI = %q, 期望 b.test", sni)
+	}
+
+	for _, policy := range []RedirectPolicy{RedirectSameHost, RedirectNone} {
+		resp, err := newClient(policy, 0).Get(aURL+"/start", nil)
+		if err != nil || resp.StatusCode != http.StatusFound || len(resp.Redirects) != 0 {
+			t.Fatalf("策略 %d 应返回 302 响应，实际 %v, err=%v", policy, resp, err)
+		}
+	}
+}
+
+// dnsTestAnswer 对 A 查询返回 127.0.0.1，对其它类型返回空应答
+func dnsTestAnswer(query []byte) []byte {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(query); err != nil || len(msg.Questions) != 1 {
+		return nil
+	}
+	msg.Header.Response = true
+	if q := msg.Questions[0]; q.Type == dnsmessage.TypeA {
+		msg.Answers = []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+			Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}},
+		}}
+	}
+	answer, _ := msg.Pack()
+	return answer
+}
+
+// serveH2Once 极简 HTTP/2 服务端：接收一个请求，返回 200 并上报收到的头部字段
+func serveH2Once(conn net.Conn, received chan<- []hpack.HeaderField) {
+	preface := make([]byte, len(http2.ClientPreface))
+	if _, err := io.ReadFull(conn, preface); err != nil {
+		return
+	}
+	framer := http2.NewFramer(conn, conn)
+	framer.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	if err := framer.WriteSettings(); err != nil {
+		return
+	}
+	for {
+		frame, err := framer.ReadFrame()
+		if err != nil {
+			return
+		}
+		switch f := frame.(type) {
+		case *http2.SettingsFrame:
+			if !f.IsAck() {
+				framer.WriteSettingsAck()
+			}
+		case *http2.MetaHeadersFrame:
+			received <- f.Fields
+			var block bytes.Buffer
+			hpack.NewEncoder(&block).WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+			framer.WriteHeaders(http2.HeadersFrameParam{
+				StreamID:      f.StreamID,
+				BlockFragment: block.Bytes(),
+				EndStream:     true,
+				EndHeaders:    true,
+			})
+		}
+	}
+}
+
+// newConnectProxy 要求 Basic 认证的 HTTP CONNECT 代理
+func newConnectProxy(username, password string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := (&http.Request{Header: http.Header{"Authorization": r.Header["Proxy-Authorization"]}}).BasicAuth()
+		if r.Method != http.MethodConnect || !ok || user != username || pass != password {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		pipeConns(conn, upstream)
+	}
+}
+
+// socks5Proxy 要求用户名/密码认证的 SOCKS5 代理，记录每个请求的地址类型
+type socks5Proxy struct {
+	net.Listener
+	addrTypes chan byte
+}
+
+func newSOCKS5Proxy(t *testing.T, username, password string) *socks5Proxy {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	p := &socks5Proxy{Listener: ln, addrTypes: make(chan byte, 8)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go p.serve(conn, username, password)
+		}
+	}()
+	return p
+}
+
+func (p *socks5Proxy) serve(conn net.Conn, username, password string) {
+	buf := make([]byte, 262)
+	// 方法协商：只接受用户名/密码认证
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		conn.Close()
+		return
+	}
+	methods := buf[:buf[1]]
+	io.ReadFull(conn, methods)
+	if !bytes.Contains(methods, []byte{0x02}) {
+		conn.Write([]byte{0x05, 0xff})
+		conn.Close()
+		return
+	}
+	conn.Write([]byte{0x05, 0x02})
+
+	// RFC 1929 认证
+	io.ReadFull(conn, buf[:2])
+	user := make([]byte, buf[1])
+	io.ReadFull(conn, user)
+	io.ReadFull(conn, buf[:1])
+	pass := make([]byte, buf[0])
+	io.ReadFull(conn, pass)
+	if string(user) != username || string(pass) != password {
+		conn.Write([]byte{0x01, 0x01})
+		conn.Close()
+		return
+	}
+	conn.Write([]byte{0x01, 0x00})
+
+	// CONNECT 请求
+	if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+		conn.Close()
+		return
+	}
+	var host string
+	switch atyp := buf[3]; atyp {
+	case 0x01, 0x04:
+		ip := make(net.IP, map[byte]int{0x01: 4, 0x04: 16}[atyp])
+		io.ReadFull(conn, ip)
+		host = ip.String()
+	case 0x03:
+		io.ReadFull(conn, buf[:1])
+		name := make([]byte, buf[0])
+		io.ReadFull(conn, name)
+		host = string(name)
+	}
+	p.addrTypes <- buf[3]
+	io.ReadFull(conn, buf[:2])
+	port := int(buf[0])<<8 | int(buf[1])
+
+	upstream, err := net.Dial("tcp", net.JoinHostPort(host, fmt.Sprint(port)))
+	if err != nil {
+		conn.Write([]byte{0x05, 0x05, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		conn.Close()
+		return
+	}
+	conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 127, 0, 0, 1, 0, 0})
+	pipeConns(conn, upstream)
+}
+
+// pipeConns 双向转发直到任一方向结束
+func pipeConns(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() { io.Copy(a, b); done <- struct{}{} }()
+	go func() { io.Copy(b, a); done <- struct{}{} }()
+	<-done
+	a.Close()
+	b.Close()
+}
+
+func TestRetryPolicy(t *testing.T) {
+	var mu sync.Mutex
+	hits := map[string]int{}
+	var remotes []string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		n := hits[r.URL.Path]
+		if r.URL.Path == "/flaky" {
+			remotes = append(remotes, r.RemoteAddr)
+		}
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/flaky":
+			if n < 3 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			fmt.Fprintf(w, "%s %s", r.Method, body)
+		case "/busy":
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "/later":
+			w.Header().Set("Retry-After", "10")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/slow":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}))
+	defer srv.Close()
+	reset := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		hits, remotes = map[string]int{}, nil
+	}
+
+	policy := &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Rotate: RotateConnection | RotateFingerprint}
+	c := NewClient(nil, &Config{Timeout: 5 * time.Second, InsecureSkipVerify: true, RetryPolicy: policy})
+	defer c.Close()
+
+	// 503 后重试成功，每次尝试使用新连接
+	resp, err := c.Get(srv.URL+"/flaky", nil)
+	if err != nil || resp.StatusCode != http.StatusOK || resp.Attempts != 3 {
+		t.Fatalf("重试后响应 = %v, err=%v", resp, err)
+	}
+	if len(remotes) != 3 || remotes[0] == remotes[1] || remotes[1] == remotes[2] {
+		t.Fatalf("RotateConnection 应每次使用新连接，实际 %v", remotes)
+	}
+
+	// 次数用尽时返回最后一次的响应
+	resp, err = c.Get(srv.URL+"/busy", nil)
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests || resp.Attempts != 3 {
+		t.Fatalf("次数用尽后响应 = %v, err=%v", resp, err)
+	}
+
+	// 非幂等请求默认不重试，带 Idempotency-Key 时重试并重放请求体
+	reset()
+	resp, err = c.Post(srv.URL+"/flaky", nil, strings.NewReader("payload"))
+	if err != nil || resp.StatusCode != http.StatusServiceUnavailable || resp.Attempts != 1 {
+		t.Fatalf("POST 不应重试，实际 %v, err=%v", resp, err)
+	}
+	reset()
+	resp, err = c.Post(srv.URL+"/flaky", map[string]string{"Idempotency-Key": "k1"}, strings.NewReader("payload"))
+	if err != nil || string(resp.Body) != "POST payload" || resp.Attempts != 3 {
+		t.Fatalf("带 Idempotency-Key 的 POST 响应 = %v, err=%v", resp, err)
+	}
+
+	// 不重试的路径（无策略、请求体不可重放）同样记为 1 次尝试
+	plain := NewClient(nil, &Config{Timeout: 5 * time.Second, InsecureSkipVerify: true})
+	defer plain.Close()
+	if resp, err := plain.Get(srv.URL+"/busy", nil); err != nil || resp.Attempts != 1 {
+		t.Fatalf("无重试策略时尝试次数 = %v, err=%v", resp, err)
+	}
+	resp, err = c.Post(srv.URL+"/busy", map[string]string{"Idempotency-Key": "k2"}, io.MultiReader(strings.NewReader("payload")))
+	if err != nil || resp.Attempts != 1 {
+		t.Fatalf("请求体不可重放时尝试次数 = %v, err=%v", resp, err)
+	}
+
+	// 流式响应同样返回尝试次数
+	reset()
+	stream, err := c.GetStream(context.Background(), srv.URL+"/flaky", nil)
+	if err != nil || stream.Attempts != 3 {
+		t.Fatalf("流式重试后响应 = %v, err=%v", stream, err)
+	}
+	stream.Close()
+	stream, err = plain.GetStream(context.Background(), srv.URL+"/busy", nil)
+	if err != nil || stream.Attempts != 1 {
+		t.Fatalf("无重试策略的流式响应 = %v, err=%v", stream, err)
+	}
+	stream.Close()
+
+	// Retry-After 超出预算时直接返回
+	start := time.Now()
+	resp, err = c.Do("GET", srv.URL+"/later", &RequestConfig{
+		RetryPolicy: &RetryPolicy{MaxAttempts: 3, Budget: time.Second},
+	})
+	if err != nil || resp.StatusCode != http.StatusServiceUnavailable || resp.Attempts != 1 || time.Since(start) > time.Second {
+		t.Fatalf("超出预算时响应 = %v, err=%v", resp, err)
+	}
+
+	// 未设置预算时 Retry-After 最多等待 MaxBackoff
+	start = time.Now()
+	resp, err = c.Do("GET", srv.URL+"/later", &RequestConfig{
+		RetryPolicy: &RetryPolicy{MaxAttempts: 2, MaxBackoff: 50 * time.Millisecond},
+	})
+	if err != nil || resp.Attempts != 2 || time.Since(start) > time.Second {
+		t.Fatalf("Retry-After 应被限制在 MaxBackoff 内，实际 %v, err=%v，耗时 %v", resp, err, time.Since(start))
+	}
+
+	// 预算作为截止时间，进行中的慢请求也不会超出
+	start = time.Now()
+	_, err = c.Do("GET", srv.URL+"/slow", &RequestConfig{
+		RetryPolicy: &RetryPolicy{MaxAttempts: 3, Budget: 200 * time.Millisecond, RetryOn: RetryOnDefault | RetryOnTimeout},
+	})
+	if !errors.Is(err, ErrTimeout) || time.Since(start) > time.Second {
+		t.Fatalf("超出预算的请求应超时返回，实际 %v，耗时 %v", err, time.Since(start))
+	}
+
+	// 连接失败按错误类别重试，错误中注明尝试次数
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := ln.Addr().String()
+	ln.Close()
+	_, err = c.Get("https://"+closed+"/", nil)
+	if err == nil || classifyError(err) != RetryOnDial || !strings.Contains(err.Error(), "共尝试 3 次") {
+		t.Fatalf("连接失败应重试 3 次，实际 %v", err)
+	}
+
+	// TLS 握手失败归为 RetryOnHandshake
+	hangup, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hangup.Close()
+	go func() {
+		for {
+			conn, err := hangup.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, err = c.Get("https://"+hangup.Addr().String()+"/", nil)
+	if classifyError(err) != RetryOnHandshake || !strings.Contains(err.Error(), "共尝试 3 次") {
+		t.Fatalf("握手失败应归为 RetryOnHandshake 并重试，实际 %v", err)
+	}
+
+	// RotateRemoteIP：握手失败的 IP 在重试时被避开
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	broken, err := net.Listen("tcp", net.JoinHostPort("127.0.0.2", port))
+	if err != nil {
+		t.Skipf("无法监听 127.0.0.2: %v", err)
+	}
+	defer broken.Close()
+	go func() {
+		for {
+			conn, err := broken.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	hosts, _ := NewHostsResolver(map[string][]string{"multi.test": {"127.0.0.2", "127.0.0.1"}}, nil)
+	rotating := NewClient(nil, &Config{Timeout: 5 * time.Second, InsecureSkipVerify: true, Resolver: hosts,
+		RetryPolicy: &RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond, Rotate: RotateRemoteIP}})
+	defer rotating.Close()
+	resp, err = rotating.Get("https://"+net.JoinHostPort("multi.test", port)+"/flaky", nil)
+	if err != nil || resp.Attempts != 2 || !strings.HasPrefix(resp.RemoteAddr, "127.0.0.1:") {
+		t.Fatalf("重试应避开握手失败的 IP，实际 %v, err=%v", resp, err)
+	}
+}
+
+func TestErrorTaxonomy(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/short":
+			w.Header().Set("Content-Length", "100")
+			io.WriteString(w, "short")
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		case "/slow":
+			time.Sleep(300 * time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+	legacy := httptest.NewUnstartedServer(http.NotFoundHandler())
+	legacy.TLS = &tls.Config{MinVersion: tls.VersionTLS10, MaxVersion: tls.VersionTLS10}
+	legacy.StartTLS()
+	defer legacy.Close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := ln.Addr().String()
+	ln.Close()
+
+	noDNS := &net.Resolver{PreferGo: true, Dial: func(context.Context, string, string) (net.Conn, error) {
+		return nil, errors.New("DNS 不可用")
+	}}
+	newClient := func(config Config) *Client {
+		config.InsecureSkipVerify, config.Timeout = true, 5*time.Second
+		return NewClient(nil, &config)
+	}
+	proxy, _ := ParseProxyChain("http://" + closed)
+
+	tests := []struct {
+		name   string
+		client *Client
+		target string
+		stage  ErrorStage
+		is     []error
+	}{
+		{"解析", newClient(Config{Resolver: noDNS}), "https://nxdomain.test/", StageResolve, []error{ErrResolve}},
+		{"连接", newClient(Config{}), "https://" + closed + "/", StageConnect, []error{ErrConnect, syscall.ECONNREFUSED}},
+		{"代理", newClient(Config{ProxyProvider: proxy}), srv.URL, StageProxy, []error{ErrProxy, ErrConnect}},
+		{"TLS", newClient(Config{}), legacy.URL, StageTLS, []error{ErrTLSHandshake}},
+		{"ALPN", newClient(Config{Protocol: ProtocolHTTP2}), srv.URL, StageALPN, []error{ErrALPNMismatch}},
+		{"超时", NewClient(nil, &Config{InsecureSkipVerify: true, Timeout: 100 * time.Millisecond}), srv.URL + "/slow", StageRequest, []error{ErrRequest, ErrTimeout}},
+		{"响应体", newClient(Config{}), srv.URL + "/short", StageBody, []error{ErrReadBody, io.ErrUnexpectedEOF}},
+	}
+	for _, tt := range tests {
+		_, err := tt.client.Get(tt.target, nil)
+		var e *Error
+		if !errors.As(err, &e) || e.Stage != tt.stage {
+			t.Fatalf("%s: 错误阶段应为 %v，实际 %v", tt.name, tt.stage, err)
+		}
+		for _, target := range tt.is {
+			if !errors.Is(err, target) {
+				t.Fatalf("%s: errors.Is(%v, %v) 应为 true", tt.name, err, target)
+			}
+		}
+		if tt.stage != StageRequest && errors.Is(err, ErrTimeout) {
+			t.Fatalf("%s: 不应判为超时: %v", tt.name, err)
+		}
+		tt.client.Close()
+	}
+
+	// 服务器不支持客户端的 TLS 版本时发送 protocol_version 告警
+	_, err = newClient(Config{}).Get(legacy.URL, nil)
+	if alert, remote, ok := TLSAlert(err); !ok || !remote || alert != 70 {
+		t.Fatalf("TLS 告警 = %d, remote=%v, ok=%v（%v）", alert, remote, ok, err)
+	}
+	if !HandshakeRejected(err) {
+		t.Fatalf("收到对端告警应判为握手被拒绝: %v", err)
+	}
+
+	// 握手中连接被对端关闭判为拒绝；本端校验失败（公钥固定不匹配、证书不受信任）与其它阶段的错误不算
+	hangup, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hangup.Close()
+	go func() {
+		for {
+			conn, err := hangup.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, err = newClient(Config{}).Get("https://"+hangup.Addr().String()+"/", nil)
+	if !HandshakeRejected(err) {
+		t.Fatalf("握手中连接被关闭应判为握手被拒绝: %v", err)
+	}
+	_, err = newClient(Config{PinnedKeys: map[string][]string{"127.0.0.1": {"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="}}}).Get(srv.URL, nil)
+	if !errors.Is(err, ErrPinMismatch) || !errors.Is(err, ErrTLSHandshake) || HandshakeRejected(err) {
+		t.Fatalf("公钥固定不匹配不应判为握手被拒绝: %v", err)
+	}
+	_, err = NewClient(nil, &Config{Timeout: 5 * time.Second}).Get(srv.URL, nil)
+	if !errors.Is(err, ErrTLSHandshake) || HandshakeRejected(err) {
+		t.Fatalf("证书不受信任不应判为握手被拒绝: %v", err)
+	}
+	_, err = newClient(Config{}).Get("https://"+closed+"/", nil)
+	if HandshakeRejected(err) {
+		t.Fatalf("连接失败不应判为握手被拒绝: %v", err)
+	}
+}
+
+func TestCertificateVerification(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+	// httptest 的证书签发给 example.com、*.example.com 与 127.0.0.1
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	roots, err := LoadRootCAs(caFile)
+	if err != nil {
+		t.Fatalf("加载根证书失败: %v", err)
+	}
+	pin := SPKIHash(srv.Certificate())
+
+	var seen []string
+	tests := []struct {
+		name   string
+		config Config
+		err    error
+	}{
+		{"系统根证书", Config{}, ErrTLSHandshake},
+		{"自定义根证书", Config{RootCAs: roots}, nil},
+		{"按域名校验 IP 连接", Config{RootCAs: roots, VerifyHostname: "example.com"}, nil},
+		{"域名不匹配", Config{RootCAs: roots, VerifyHostname: "kh.google.com"}, ErrTLSHandshake},
+		{"公钥匹配", Config{RootCAs: roots, VerifyHostname: "www.example.com", PinnedKeys: map[string][]string{
+			"*.example.com": {"sha256/" + pin},
+		}}, nil},
+		{"公钥匹配（跳过链校验）", Config{InsecureSkipVerify: true, VerifyHostname: "www.example.com", PinnedKeys: map[string][]string{
+			"*.example.com": {"sha256/" + pin},
+		}}, nil},
+		{"公钥不匹配", Config{InsecureSkipVerify: true, PinnedKeys: map[string][]string{
+			"127.0.0.1": {base64.StdEncoding.EncodeToString(make([]byte, 32))},
+		}}, ErrPinMismatch},
+		{"自定义回调", Config{RootCAs: roots, VerifyHostname: "example.com", VerifyCertificate: func(host string, chain []*x509.Certificate) error {
+			seen = append(seen, host, chain[0].Subject.Organization[0])
+			return nil
+		}}, nil},
+	}
+	for _, tt := range tests {
+		config := tt.config
+		config.Timeout = 5 * time.Second
+		c := NewClient(nil, &config)
+		resp, err := c.Get(srv.URL, nil)
+		c.Close()
+		if tt.err == nil && (err != nil || string(resp.Body) != "ok") {
+			t.Fatalf("%s: 请求应成功，实际 %v", tt.name, err)
+		}
+		if tt.err != nil && !errors.Is(err, tt.err) {
+			t.Fatalf("%s: 错误应为 %v，实际 %v", tt.name, tt.err, err)
+		}
+	}
+	if len(seen) != 2 || seen[0] != "example.com" || seen[1] != "Acme Co" {
+		t.Fatalf("回调参数 = %v", seen)
+	}
+}
+
+func TestConnPoolManager(t *testing.T) {
+	var newConns atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s|%s|%s|%s", r.Proto, r.Host, r.TLS.ServerName, r.URL.Path)
+	}))
+	srv.EnableHTTP2 = true
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			newConns.Add(1)
+		}
+	}
+	srv.StartTLS()
+	defer srv.Close()
+	remote := srv.Listener.Addr().String()
+
+	m := NewConnPoolManager(utls.HelloChrome_133, &Config{Timeout: 5 * time.Second, ServerName: "kh.google.com", InsecureSkipVerify: true})
+	m.SetPingInterval(20 * time.Millisecond)
+	if err := m.WarmUp([]string{remote}); err != nil {
+		t.Fatalf("预热失败: %v", err)
+	}
+	if !m.Warm(remote) || newConns.Load() != 1 {
+		t.Fatalf("预热后应有一条连接，实际 warm=%v conns=%d", m.Warm(remote), newConns.Load())
+	}
+
+	for range 3 {
+		resp, err := m.Do(context.Background(), remote, &RequestConfig{Path: "/rt/earth/PlanetoidMetadata"})
+		if err != nil {
+			t.Fatalf("请求失败: %v", err)
+		}
+		if want := "HTTP/2.0|kh.google.com|kh.google.com|/rt/earth/PlanetoidMetadata"; string(resp.Body) != want || resp.RemoteAddr != remote || resp.Attempts != 1 {
+			t.Fatalf("响应 = %q（%s，尝试 %d 次），期望 %q", resp.Body, resp.RemoteAddr, resp.Attempts, want)
+		}
+	}
+	if newConns.Load() != 1 {
+		t.Fatalf("请求应复用预热的连接，实际建立了 %d 条", newConns.Load())
+	}
+
+	// 服务端断开后由保活重建连接
+	srv.CloseClientConnections()
+	deadline := time.Now().Add(2 * time.Second)
+	for (newConns.Load() < 2 || !m.Warm(remote)) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if newConns.Load() != 2 || !m.Warm(remote) {
+		t.Fatalf("断开后应重建连接，实际 conns=%d warm=%v", newConns.Load(), m.Warm(remote))
+	}
+
+	if err := m.WarmUp([]string{"not-an-ip"}); err == nil {
+		t.Fatal("无效的远端 IP 应返回错误")
+	}
+}
+
+func TestConnPoolHealth(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/blocked" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	remote := srv.Listener.Addr().String()
+
+	m := NewConnPoolManager(utls.HelloChrome_133, &Config{Timeout: 5 * time.Second, InsecureSkipVerify: true})
+	m.SetHealthOptions(IPHealthOptions{MaxFailures: 2, Probation: 50 * time.Millisecond, MaxProbation: time.Second})
+	do := func(path string) error {
+		_, err := m.Do(context.Background(), remote, &RequestConfig{Path: path})
+		return err
+	}
+
+	if err := do("/"); err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	do("/blocked")
+	do("/blocked")
+	status, _ := m.IPHealth(remote)
+	if status.State != IPQuarantined || status.Connected || status.Forbidden != 2 || status.Requests != 3 ||
+		status.LatencyP50 <= 0 || !strings.Contains(status.QuarantineReason, "连续失败 2 次") {
+		t.Fatalf("连续 403 后应被隔离，实际 %+v", status)
+	}
+	if err := do("/"); !errors.Is(err, ErrIPQuarantined) {
+		t.Fatalf("隔离期内应拒绝请求，实际 %v", err)
+	}
+
+	// 探测失败时隔离时长翻倍
+	time.Sleep(60 * time.Millisecond)
+	start := time.Now()
+	do("/blocked")
+	status, _ = m.IPHealth(remote)
+	if status.State != IPQuarantined || status.Quarantines != 2 || !strings.HasPrefix(status.QuarantineReason, "探测失败") ||
+		status.QuarantinedUntil.Sub(start) < 100*time.Millisecond {
+		t.Fatalf("探测失败后应再次隔离 100ms，实际 %+v", status)
+	}
+
+	// 探测成功后重新接纳
+	time.Sleep(110 * time.Millisecond)
+	if err := do("/"); err != nil {
+		t.Fatalf("探测请求失败: %v", err)
+	}
+	if health := m.Health(); len(health) != 1 || health[0].State != IPHealthy || !health[0].Connected {
+		t.Fatalf("探测成功后应重新接纳，实际 %+v", health)
+	}
+}
+
+func TestConnPoolSelector(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Host)
+	}))
+	// 监听所有地址，使 127.0.0.1 与 127.0.0.2 都能连到同一服务
+	listener, err := net.Listen("tcp4", "0.0.0.0:0")
+	if err != nil {
+		t.Skipf("无法监听: %v", err)
+	}
+	srv.Listener.Close()
+	srv.Listener = listener
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	ip1, ip2 := net.JoinHostPort("127.0.0.1", port), net.JoinHostPort("127.0.0.2", port)
+
+	hosts, _ := NewHostsResolver(map[string][]string{"pool.test": {"127.0.0.1", "127.0.0.2"}}, nil)
+	m := NewConnPoolManager(utls.HelloChrome_133, &Config{Timeout: 5 * time.Second, InsecureSkipVerify: true, Resolver: hosts})
+	target := net.JoinHostPort("pool.test", port)
+	do := func(req *RequestConfig) (string, error) {
+		resp, err := m.Do(context.Background(), target, req)
+		if err != nil {
+			return "", err
+		}
+		if string(resp.Body) != "pool.test" {
+			t.Fatalf(":authority 应为主机名，实际 %q", resp.Body)
+		}
+		return resp.RemoteAddr, nil
+	}
+
+	// 默认轮询
+	var got []string
+	for range 4 {
+		addr, err := do(&RequestConfig{Path: "/"})
+		if err != nil {
+			t.Fatalf("请求失败: %v", err)
+		}
+		got = append(got, addr)
+	}
+	if got[0] == got[1] || got[0] != got[2] || got[1] != got[3] {
+		t.Fatalf("轮询应交替选择 IP，实际 %v", got)
+	}
+
+	// 一致性哈希：同一分片键固定落在同一 IP，不同键分散到两个 IP
+	m.SetSelector(NewConsistentHashSelector())
+	seen := map[string]string{}
+	for i := range 20 {
+		key := fmt.Sprintf("0%d", i)
+		for range 2 {
+			addr, err := do(&RequestConfig{Path: "/rt/earth/NodeData/pb=!1m2!1s" + key, ShardKey: key})
+			if err != nil {
+				t.Fatalf("请求失败: %v", err)
+			}
+			if prev, ok := seen[key]; ok && prev != addr {
+				t.Fatalf("分片键 %s 先后落在 %s 与 %s", key, prev, addr)
+			}
+			seen[key] = addr
+		}
+	}
+	counts := map[string]int{}
+	for _, addr := range seen {
+		counts[addr]++
+	}
+	if counts[ip1] == 0 || counts[ip2] == 0 {
+		t.Fatalf("分片键应分散到两个 IP，实际 %v", counts)
+	}
+
+	// 隔离中的 IP 不参与选择，全部隔离时返回 ErrIPQuarantined
+	for range 3 {
+		m.MarkResult(ip1, http.StatusForbidden, nil)
+	}
+	for key := range seen {
+		if addr, err := do(&RequestConfig{ShardKey: key}); err != nil || addr != ip2 {
+			t.Fatalf("隔离后应只选择 %s，实际 %s（%v）", ip2, addr, err)
+		}
+	}
+	for range 3 {
+		m.MarkResult(ip2, http.StatusForbidden, nil)
+	}
+	if _, err := do(&RequestConfig{}); !errors.Is(err, ErrIPQuarantined) {
+		t.Fatalf("全部隔离时应返回 ErrIPQuarantined，实际 %v", err)
+	}
+
+	candidates := []IPCandidate{
+		{IP: "a", InFlight: 3, Latency: 10 * time.Millisecond},
+		{IP: "b", InFlight: 1, Latency: 30 * time.Millisecond},
+	}
+	if i := NewLeastInFlightSelector().Select("", candidates); i != 1 {
+		t.Fatalf("最少进行中请求应选择 b，实际 %d", i)
+	}
+	if i := NewP2CSelector().Select("", candidates); i != 0 {
+		t.Fatalf("二选一应选择延迟较低的 a，实际 %d", i)
+	}
+}
+
+func TestConnPoolStreamLimit(t *testing.T) {
+	release := make(chan struct{})
+	var newConns atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-release
+		}
+	}))
+	srv.EnableHTTP2 = true
+	srv.Config.HTTP2 = &http.HTTP2Config{MaxConcurrentStreams: 2}
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			newConns.Add(1)
+		}
+	}
+	srv.StartTLS()
+	defer srv.Close()
+	remote := srv.Listener.Addr().String()
+
+	m := NewConnPoolManager(utls.HelloChrome_133, &Config{Timeout: 5 * time.Second, InsecureSkipVerify: true})
+	m.SetMaxConnsPerIP(2)
+
+	// 5 个并发请求：两条连接各占满 2 个流，第 5 个在连接上排队
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := m.Do(context.Background(), remote, &RequestConfig{Path: "/slow"})
+			errs <- err
+		}()
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	active := func() (streams, pending int, stats []PoolConnStats) {
+		stats = m.ConnStats()
+		for _, s := range stats {
+			streams += s.ActiveStreams
+			pending += s.PendingStreams
+		}
+		return
+	}
+	for streams, pending, _ := active(); streams+pending < 5 && time.Now().Before(deadline); streams, pending, _ = active() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	streams, pending, stats := active()
+	if len(stats) != 2 || streams != 4 || pending != 1 || newConns.Load() != 2 {
+		t.Fatalf("期望 2 条连接、4 个进行中流、1 个排队，实际 conns=%d streams=%d pending=%d stats=%+v", newConns.Load(), streams, pending, stats)
+	}
+	for _, s := range stats {
+		if s.MaxConcurrentStreams != 2 || s.RemoteIP != remote || s.Age <= 0 {
+			t.Fatalf("连接状态不正确: %+v", s)
+		}
+	}
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("请求失败: %v", err)
+		}
+	}
+	var requests uint64
+	for _, s := range m.ConnStats() {
+		requests += s.Requests
+	}
+	if requests != 5 {
+		t.Fatalf("两条连接共应发送 5 个请求，实际 %d", requests)
+	}
+
+	// 服务端优雅关闭时发送 GOAWAY
+	go srv.Config.Shutdown(context.Background())
+	deadline = time.Now().Add(2 * time.Second)
+	for len(m.GoAways(remote)) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	goAways := m.GoAways("")
+	if len(goAways) == 0 || goAways[0].RemoteIP != remote || goAways[0].ErrCode != http2.ErrCodeNo || goAways[0].ConnAge <= 0 {
+		t.Fatalf("应记录 GOAWAY，实际 %+v", goAways)
+	}
+}
+
+func TestConnPoolDialUnlocked(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	srv.EnableHTTP2 = true
+	srv.Config.HTTP2 = &http.HTTP2Config{MaxConcurrentStreams: 1}
+	srv.StartTLS()
+	defer srv.Close()
+	defer close(release)
+
+	// 第一条连接转发到服务端，之后的连接接受后不响应（拨号停在 TLS 握手）
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	stalled := make(chan struct{}, 1)
+	go func() {
+		for first := true; ; first = false {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			if !first {
+				defer conn.Close()
+				stalled <- struct{}{}
+				continue
+			}
+			upstream, err := net.Dial("tcp", srv.Listener.Addr().String())
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			go pipeConns(conn, upstream)
+		}
+	}()
+	remote := ln.Addr().String()
+
+	m := NewConnPoolManager(utls.HelloChrome_133, &Config{Timeout: 5 * time.Second, InsecureSkipVerify: true})
+	m.SetMaxConnsPerIP(2)
+	if err := m.WarmUp([]string{remote}); err != nil {
+		t.Fatalf("预热失败: %v", err)
+	}
+	// 第一个请求占满唯一的流，第二个请求触发拨号并停在握手
+	for range 2 {
+		go m.Do(context.Background(), remote, &RequestConfig{Path: "/"})
+		time.Sleep(50 * time.Millisecond)
+	}
+	select {
+	case <-stalled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("第二个请求应触发新的拨号")
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	// 拨号期间状态查询不被阻塞
+	start := time.Now()
+	warm, stats := m.Warm(remote), m.ConnStats()
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond || !warm || len(stats) != 1 {
+		t.Fatalf("拨号期间查询应立即返回，实际耗时 %v warm=%v stats=%+v", elapsed, warm, stats)
+	}
+}
+
+// TestConnPoolWarmUpConcurrency 测试预热同时进行的拨号数不超过设置的上限
+func TestConnPoolWarmUpConcurrency(t *testing.T) {
+	// 接受连接后保持一段时间再断开（握手失败），记录同时进行的握手数
+	ln, err := net.Listen("tcp", "0.0.0.0:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	var active, peak, total atomic.Int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			total.Add(1)
+			n := active.Add(1)
+			for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+			}
+			go func() {
+				time.Sleep(30 * time.Millisecond)
+				active.Add(-1)
+				conn.Close()
+			}()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	var remotes []string
+	for i := 1; i <= 12; i++ {
+		remotes = append(remotes, net.JoinHostPort(fmt.Sprintf("127.0.0.%d", i), port))
+	}
+	m := NewConnPoolManager(utls.HelloChrome_133, &Config{Timeout: 5 * time.Second, InsecureSkipVerify: true})
+	defer m.Close()
+	m.SetWarmUpConcurrency(3)
+	if err := m.WarmUp(remotes); err == nil {
+		t.Fatal("握手失败时预热应返回错误")
+	}
+	if n, p := total.Load(), peak.Load(); n != int32(len(remotes)) || p > 3 || p < 2 {
+		t.Fatalf("拨号 %d 次（期望 %d），同时进行的握手峰值 %d（上限 3）", n, len(remotes), p)
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	entered, release := make(chan struct{}, 8), make(chan struct{})
+	var newConns, closedConns atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			entered <- struct{}{}
+			<-release
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	srv.EnableHTTP2 = true
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			newConns.Add(1)
+		case http.StateClosed:
+			closedConns.Add(1)
+		}
+	}
+	srv.StartTLS()
+	defer srv.Close()
+	remote := srv.Listener.Addr().String()
+	waitFor := func(cond func() bool) bool {
+		deadline := time.Now().Add(2 * time.Second)
+		for !cond() && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		return cond()
+	}
+
+	// Client 关闭：立即拒绝新请求，进行中的请求完成后其归还的连接随之关闭（HTTP/1.1 与 HTTP/2）
+	for _, protocol := range []HTTPProtocol{ProtocolHTTP1, ProtocolHTTP2} {
+		client := NewClient(&utls.HelloChrome_133, &Config{Timeout: 5 * time.Second, InsecureSkipVerify: true, Protocol: protocol})
+		if _, err := client.Get(srv.URL+"/", nil); err != nil {
+			t.Fatalf("请求失败: %v", err)
+		}
+		done := make(chan error, 1)
+		go func() {
+			_, err := client.Get(srv.URL+"/slow", nil)
+			done <- err
+		}()
+		<-entered
+		client.Close()
+		if _, err := client.Get(srv.URL+"/", nil); !errors.Is(err, ErrClosed) {
+			t.Fatalf("关闭后新请求应返回 ErrClosed，实际 %v", err)
+		}
+		release <- struct{}{}
+		if err := <-done; err != nil {
+			t.Fatalf("进行中的请求应完成: %v", err)
+		}
+		if !waitFor(func() bool { return closedConns.Load() == newConns.Load() }) {
+			t.Fatalf("协议 %v：关闭后连接应全部关闭，建立 %d 条，关闭 %d 条", protocol, newConns.Load(), closedConns.Load())
+		}
+	}
+
+	// Client 排空：进行中的请求完成，新请求被拒绝，结束后关闭连接
+	client := NewClient(&utls.HelloChrome_133, &Config{Timeout: 5 * time.Second, InsecureSkipVerify: true})
+	done := make(chan error, 1)
+	go func() {
+		resp, err := client.Get(srv.URL+"/slow", nil)
+		if err == nil && string(resp.Body) != "ok" {
+			err = fmt.Errorf("响应 = %q", resp.Body)
+		}
+		done <- err
+	}()
+	<-entered
+	drained := make(chan error, 1)
+	go func() { drained <- client.Drain(context.Background()) }()
+	if !waitFor(client.life.isClosed) {
+		t.Fatal("Drain 应立即拒绝新请求")
+	}
+	if _, err := client.Get(srv.URL+"/", nil); !errors.Is(err, ErrClosed) {
+		t.Fatalf("排空期间新请求应返回 ErrClosed，实际 %v", err)
+	}
+	release <- struct{}{}
+	if err := <-done; err != nil {
+		t.Fatalf("进行中的请求应完成: %v", err)
+	}
+	if err := <-drained; err != nil {
+		t.Fatalf("Drain 失败: %v", err)
+	}
+	if !waitFor(func() bool { return closedConns.Load() == newConns.Load() }) {
+		t.Fatalf("排空后应关闭连接，建立 %d 条，关闭 %d 条", newConns.Load(), closedConns.Load())
+	}
+
+	// 连接池按最大存活时长轮换连接
+	m := NewConnPoolManager(utls.HelloChrome_133, &Config{Timeout: 5 * time.Second, InsecureSkipVerify: true})
+	m.SetMaxConnAge(150*time.Millisecond, 50*time.Millisecond)
+	base := newConns.Load()
+	if err := m.WarmUp([]string{remote}); err != nil {
+		t.Fatalf("预热失败: %v", err)
+	}
+	if !waitFor(func() bool { return newConns.Load() >= base+3 }) {
+		t.Fatalf("连接应按存活时长轮换，实际新建 %d 条", newConns.Load()-base)
+	}
+	if stats := m.ConnStats(); len(stats) != 1 || stats[0].Age > time.Second {
+		t.Fatalf("轮换后应只保留一条未过期的连接，实际 %+v", stats)
+	}
+
+	// 连接池排空
+	go func() {
+		_, err := m.Do(context.Background(), remote, &RequestConfig{Path: "/slow"})
+		done <- err
+	}()
+	<-entered
+	go func() { drained <- m.Drain(context.Background()) }()
+	if !waitFor(m.life.isClosed) {
+		t.Fatal("Drain 应立即拒绝新请求")
+	}
+	if _, err := m.Do(context.Background(), remote, &RequestConfig{}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("排空期间新请求应返回 ErrClosed，实际 %v", err)
+	}
+	release <- struct{}{}
+	if err := <-done; err != nil {
+		t.Fatalf("进行中的请求应完成: %v", err)
+	}
+	if err := <-drained; err != nil {
+		t.Fatalf("Drain 失败: %v", err)
+	}
+	if len(m.ConnStats()) != 0 || m.Warm(remote) {
+		t.Fatalf("排空后不应保留连接，实际 %+v", m.ConnStats())
+	}
+	if err := m.WarmUp([]string{remote}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("关闭后预热应返回 ErrClosed，实际 %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package utls_client
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrClosed 客户端或连接池已关闭（或正在排空），不再接受新请求
+var ErrClosed = errors.New("已关闭，不再接受新请求")
+
+// lifecycle 跟踪进行中的请求：关闭（含排空）后拒绝新请求，排空时等待进行中的请求结束
+type lifecycle struct {
+	mu     sync.Mutex
+	closed bool
+	active int           // 进行中的请求数
+	done   chan struct{} // 关闭时关闭，通知后台协程退出
+	idle   chan struct{} // 关闭后进行中的请求全部结束时关闭
+
+	// onIdle 关闭后进行中的请求全部结束时调用一次（如关闭这些请求归还的空闲连接）
+	onIdle func()
+}
+
+func newLifecycle(onIdle func()) *lifecycle {
+	return &lifecycle{done: make(chan struct{}), idle: make(chan struct{}), onIdle: onIdle}
+}
+
+// begin 开始一个请求，已关闭时返回 ErrClosed；成功时调用方结束后必须调用 end
+func (l *lifecycle) begin() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return ErrClosed
+	}
+	l.active++
+	return nil
+}
+
+// end 结束一个请求
+func (l *lifecycle) end() {
+	l.mu.Lock()
+	l.active--
+	idle := l.closed && l.active == 0
+	l.mu.Unlock()
+	if idle {
+		l.becomeIdle()
+	}
+}
+
+// shutdown 停止接受新请求（可重复调用）
+func (l *lifecycle) shutdown() {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return
+	}
+	l.closed = true
+	close(l.done)
+	idle := l.active == 0
+	l.mu.Unlock()
+	if idle {
+		l.becomeIdle()
+	}
+}
+
+// becomeIdle 关闭后最后一个请求结束（关闭后 active 只减不增，只会发生一次）
+func (l *lifecycle) becomeIdle() {
+	close(l.idle)
+	if l.onIdle != nil {
+		l.onIdle()
+	}
+}
+
+// isClosed 是否已关闭
+func (l *lifecycle) isClosed() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.closed
+}
+
+// wait 等待关闭后进行中的请求全部结束（ctx 取消时提前返回 ctx 的错误）
+func (l *lifecycle) wait(ctx context.Context) error {
+	select {
+	case <-l.idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,293 @@
+package utls_client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+	"golang.org/x/net/http2"
+)
+
+// HTTPProtocol HTTP 协议选择策略
+type HTTPProtocol int
+
+const (
+	// ProtocolAuto 按 TLS 握手的 ALPN 协商结果选择 HTTP/2 或 HTTP/1.1（默认）
+	ProtocolAuto HTTPProtocol = iota
+	// ProtocolHTTP2 https 请求仅使用 HTTP/2，服务器未协商 h2 时返回错误（明文 http 请求始终使用 HTTP/1.1）
+	ProtocolHTTP2
+	// ProtocolHTTP1 仅使用 HTTP/1.1，ALPN 只通告 http/1.1
+	ProtocolHTTP1
+)
+
+// ALPN 协议标识
+const (
+	protoHTTP2 = "h2"
+	protoHTTP1 = "http/1.1"
+)
+
+// handoffTimeout 移交的连接无人取用时的关闭时间
+const handoffTimeout = 10 * time.Second
+
+// errProtocolSwitch 拨号时 ALPN 协商出另一协议，连接已移交给对应的传输层（请求尚未发送）
+var errProtocolSwitch = errors.New("ALPN 协商结果与当前传输层不一致")
+
+// protocolTransport 按 ALPN 协商结果在 HTTP/2 与 HTTP/1.1 传输层之间分派请求
+// 一次拨号同时通告 h2 与 http/1.1，协商结果不是当前传输层的协议时，连接直接移交给另一传输层，不重复拨号
+type protocolTransport struct {
+	client  *Client
+	mode    HTTPProtocol
+	session string
+	h2      *http2.Transport
+	h1      *http.Transport
+
+	// 待移交的连接（键为 协议|地址）
+	mu      sync.Mutex
+	handoff map[string][]net.Conn
+}
+
+// newProtocolTransport 创建以 serverName 为 SNI 握手的协议分派传输层（singleUse 时每个连接只承载一个请求）
+func (c *Client) newProtocolTransport(serverName string, helloID *utls.ClientHelloID, localIP, session string, singleUse bool) *protocolTransport {
+	fp := *helloID
+	t := &protocolTransport{
+		client:  c,
+		mode:    c.config.Protocol,
+		session: session,
+		handoff: make(map[string][]net.Conn),
+	}
+
+	profile := c.http2Profile(&fp)
+	opts := h2ConnOptions{pseudoOrder: c.pseudoHeaderOrder(&fp), profile: profile}
+	t.h2 = newHTTP2Transport(profile, singleUse)
+	t.h2.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+		conn, err := t.dial(ctx, network, addr, serverName, &fp, localIP, protoHTTP2)
+		if err != nil {
+			return nil, err
+		}
+		return newH2FrameConn(conn, opts), nil
+	}
+
+	t.h1 = &http.Transport{
+		// 明文 http:// 请求同样经代理链、本地源地址与 Resolver 连接
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, _, err := c.dialConn(withProxySession(ctx, session), network, addr, localIP)
+			if err != nil {
+				return nil, err
+			}
+			return newH1OrderConn(conn), nil
+		},
+		DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := t.dial(ctx, network, addr, serverName, &fp, localIP, protoHTTP1)
+			if err != nil {
+				return nil, err
+			}
+			return newH1OrderConn(conn), nil
+		},
+		TLSHandshakeTimeout:   c.config.Timeout,
+		DisableCompression:    true,
+		ForceAttemptHTTP2:     false,
+		MaxIdleConns:          1000,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       60 * time.Second,
+		DisableKeepAlives:     singleUse,
+		ResponseHeaderTimeout: c.config.Timeout,
+	}
+	return t
+}
+
+// dial 为 want 协议的传输层建立 TLS 连接，优先使用另一传输层移交的连接
+func (t *protocolTransport) dial(ctx context.Context, network, addr, serverName string, helloID *utls.ClientHelloID, localIP, want string) (net.Conn, error) {
+	if conn := t.takeHandoff(want, addr); conn != nil {
+		return conn, nil
+	}
+
+	// 自动模式保持指纹自带的 ALPN（h2 与 http/1.1），强制 HTTP/1.1 时只通告 http/1.1
+	var alpn []string
+	if t.mode == ProtocolHTTP1 {
+		alpn = []string{protoHTTP1}
+	}
+	// 代理会话经 ctx 交给 ProxyProvider
+	ctx = withProxySession(ctx, t.session)
+	conn, err := t.client.dialUTLS(ctx, network, addr, serverName, helloID, localIP, alpn)
+	if err != nil {
+		return nil, err
+	}
+
+	proto := negotiatedProtocol(conn)
+	t.client.rememberProtocol(addr, proto)
+	if proto == want {
+		return conn, nil
+	}
+	if t.mode == ProtocolAuto {
+		t.putHandoff(proto, addr, conn)
+		return nil, errProtocolSwitch
+	}
+	conn.Close()
+	return nil, &Error{Stage: StageALPN, Addr: addr, Err: fmt.Errorf("服务器协商的协议为 %s，与要求的 %s 不一致", proto, want)}
+}
+
+// RoundTrip 按协议策略与已记录的源站协议选择传输层（非 https 请求始终使用 HTTP/1.1，不支持明文 HTTP/2）
+func (t *protocolTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "https" {
+		return t.h1.RoundTrip(req)
+	}
+
+	useH2 := t.mode == ProtocolHTTP2 ||
+		(t.mode == ProtocolAuto && t.client.originProtocol(originAddr(req.URL)) != protoHTTP1)
+
+	resp, err := t.roundTrip(req, useH2)
+	if err == nil || t.mode != ProtocolAuto || req.Context().Err() != nil {
+		return resp, err
+	}
+
+	switch {
+	case useH2 && errors.Is(err, errProtocolSwitch):
+		// HTTP/2 传输层拨号失败时不会读取或关闭请求体，可直接交给 HTTP/1.1
+		return t.h1.RoundTrip(req)
+	case errors.Is(err, errProtocolSwitch), useH2 && isHTTP11Required(err):
+		// 请求体可能已被读取或关闭，只有能够重放时才重试
+		if useH2 {
+			t.client.rememberProtocol(originAddr(req.URL), protoHTTP1)
+		}
+		retry, rewindErr := rewindRequest(req)
+		if rewindErr != nil {
+			return nil, fmt.Errorf("%w（%v）", err, rewindErr)
+		}
+		return t.roundTrip(retry, !useH2)
+	}
+	return nil, err
+}
+
+func (t *protocolTransport) roundTrip(req *http.Request, useH2 bool) (*http.Response, error) {
+	if useH2 {
+		return t.h2.RoundTrip(req)
+	}
+	return t.h1.RoundTrip(req)
+}
+
+// CloseIdleConnections 关闭两个传输层的空闲连接与待移交连接
+func (t *protocolTransport) CloseIdleConnections() {
+	t.h2.CloseIdleConnections()
+	t.h1.CloseIdleConnections()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, conns := range t.handoff {
+		for _, conn := range conns {
+			conn.Close()
+		}
+		delete(t.handoff, key)
+	}
+}
+
+// putHandoff 暂存待移交的连接，超时无人取用时关闭
+func (t *protocolTransport) putHandoff(proto, addr string, conn net.Conn) {
+	key := proto + "|" + addr
+	t.mu.Lock()
+	t.handoff[key] = append(t.handoff[key], conn)
+	t.mu.Unlock()
+
+	time.AfterFunc(handoffTimeout, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		conns := t.handoff[key]
+		for i, c := range conns {
+			if c == conn {
+				t.handoff[key] = append(conns[:i], conns[i+1:]...)
+				conn.Close()
+				return
+			}
+		}
+	})
+}
+
+// takeHandoff 取出一个待移交的连接（没有时返回 nil）
+func (t *protocolTransport) takeHandoff(proto, addr string) net.Conn {
+	key := proto + "|" + addr
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	conns := t.handoff[key]
+	if len(conns) == 0 {
+		return nil
+	}
+	conn := conns[0]
+	t.handoff[key] = conns[1:]
+	return conn
+}
+
+// rememberProtocol 记录源站（host:port）协商的协议
+func (c *Client) rememberProtocol(addr, proto string) {
+	c.protoMu.Lock()
+	defer c.protoMu.Unlock()
+	c.protocols[addr] = proto
+}
+
+// originProtocol 返回源站上次协商的协议（未知时为空）
+func (c *Client) originProtocol(addr string) string {
+	c.protoMu.Lock()
+	defer c.protoMu.Unlock()
+	return c.protocols[addr]
+}
+
+// OriginProtocol 返回目标 URL 所在源站上次协商的协议（"h2"、"http/1.1"，未连接过时为空）
+func (c *Client) OriginProtocol(target string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return ""
+	}
+	return c.originProtocol(originAddr(u))
+}
+
+// originAddr 返回 URL 的 host:port（与传输层拨号地址一致）
+func originAddr(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// negotiatedProtocol 返回连接协商的应用层协议（未协商 ALPN 视为 HTTP/1.1）
+func negotiatedProtocol(conn net.Conn) string {
+	if uconn, ok := conn.(*utls.UConn); ok && uconn.ConnectionState().NegotiatedProtocol == protoHTTP2 {
+		return protoHTTP2
+	}
+	return protoHTTP1
+}
+
+// isHTTP11Required 判断服务器是否以 HTTP_1_1_REQUIRED 拒绝了 HTTP/2 请求
+func isHTTP11Required(err error) bool {
+	var streamErr http2.StreamError
+	if errors.As(err, &streamErr) && streamErr.Code == http2.ErrCodeHTTP11Required {
+		return true
+	}
+	var goAway http2.GoAwayError
+	return errors.As(err, &goAway) && goAway.ErrCode == http2.ErrCodeHTTP11Required
+}
+
+// rewindRequest 返回可重新发送的请求副本（请求体通过 GetBody 重建）
+func rewindRequest(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	if req.GetBody == nil {
+		return nil, fmt.Errorf("请求体不可重放，无法重试")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, fmt.Errorf("重建请求体失败: %w", err)
+	}
+	retry := req.Clone(req.Context())
+	retry.Body = body
+	return retry, nil
+}
@@ -0,0 +1,395 @@
+package utls_client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// ProxyAuthRequiredError 代理要求认证或认证失败（HTTP 407、SOCKS5 无可用认证方式或用户名/密码被拒绝）
+type ProxyAuthRequiredError struct {
+	// 代理地址（不含认证信息）
+	Proxy string
+
+	// HTTP 代理返回的状态行（SOCKS5 为空）
+	Status string
+
+	// HTTP 代理支持的认证方式（Proxy-Authenticate）
+	Authenticate []string
+}
+
+func (e *ProxyAuthRequiredError) Error() string {
+	if e.Status != "" {
+		return fmt.Sprintf("代理 %s 要求认证: %s", e.Proxy, e.Status)
+	}
+	return fmt.Sprintf("代理 %s 要求认证或认证失败", e.Proxy)
+}
+
+// ProxyRefusedError HTTP 代理拒绝建立隧道（CONNECT 返回非 2xx 状态）
+type ProxyRefusedError struct {
+	// 代理地址（不含认证信息）
+	Proxy string
+
+	// 状态码与状态行
+	StatusCode int
+	Status     string
+}
+
+func (e *ProxyRefusedError) Error() string {
+	return fmt.Sprintf("代理 %s 拒绝 CONNECT: %s", e.Proxy, e.Status)
+}
+
+// SOCKS5 应答码（RFC 1928）
+const (
+	SOCKS5GeneralFailure          byte = 0x01
+	SOCKS5NotAllowed              byte = 0x02
+	SOCKS5NetworkUnreachable      byte = 0x03
+	SOCKS5HostUnreachable         byte = 0x04
+	SOCKS5ConnectionRefused       byte = 0x05
+	SOCKS5TTLExpired              byte = 0x06
+	SOCKS5CommandNotSupported     byte = 0x07
+	SOCKS5AddressTypeNotSupported byte = 0x08
+)
+
+// socks5ReplyNames SOCKS5 应答码名称
+var socks5ReplyNames = map[byte]string{
+	SOCKS5GeneralFailure:          "general SOCKS server failure",
+	SOCKS5NotAllowed:              "connection not allowed by ruleset",
+	SOCKS5NetworkUnreachable:      "network unreachable",
+	SOCKS5HostUnreachable:         "host unreachable",
+	SOCKS5ConnectionRefused:       "connection refused",
+	SOCKS5TTLExpired:              "TTL expired",
+	SOCKS5CommandNotSupported:     "command not supported",
+	SOCKS5AddressTypeNotSupported: "address type not supported",
+}
+
+// SOCKS5Error SOCKS5 代理以失败应答码拒绝 CONNECT
+type SOCKS5Error struct {
+	// 代理地址（不含认证信息）
+	Proxy string
+
+	// 应答码（见 SOCKS5* 常量）
+	Code byte
+}
+
+// Name 返回应答码名称
+func (e *SOCKS5Error) Name() string {
+	if name, ok := socks5ReplyNames[e.Code]; ok {
+		return name
+	}
+	return "unknown error"
+}
+
+func (e *SOCKS5Error) Error() string {
+	return fmt.Sprintf("SOCKS5 代理 %s 连接失败: %s (0x%02x)", e.Proxy, e.Name(), e.Code)
+}
+
+// bufferedConn 先返回握手时已缓冲的数据，再从底层连接读取
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	if c.r.Buffered() > 0 {
+		return c.r.Read(p)
+	}
+	return c.Conn.Read(p)
+}
+
+// connectThroughProxy 经代理链连接目标（与第一跳代理之间的连接绑定 localIP）
+// 每一跳通过隧道与下一跳握手，最后一跳连接 targetAddr
+func (c *Client) connectThroughProxy(ctx context.Context, chain ProxyChain, targetAddr, localIP string) (net.Conn, error) {
+	// 连接第一跳代理服务器
+	conn, err := c.dialTCP(ctx, "tcp", proxyAddr(chain[0]), localIP)
+	if err != nil {
+		return nil, stageError(dialStage(err), proxyAddr(chain[0]), err)
+	}
+
+	// 握手期间跟随 ctx 的取消与截止时间（各跳握手都经过这条 TCP 连接）
+	stop := watchConn(ctx, conn)
+
+	for i, hop := range chain {
+		next := targetAddr
+		if i+1 < len(chain) {
+			next = proxyAddr(chain[i+1])
+		}
+		if conn, err = c.proxyHandshake(ctx, conn, hop, next); err != nil {
+			if len(chain) > 1 {
+				err = fmt.Errorf("代理链第 %d 跳 %s: %w", i+1, proxyAddr(hop), err)
+			}
+			break
+		}
+	}
+
+	stopErr := stop()
+	if err != nil {
+		// 握手被 ctx 打断时返回 ctx 的错误，而不是底层的 i/o timeout
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+	if stopErr != nil {
+		conn.Close()
+		return nil, stopErr
+	}
+	return conn, nil
+}
+
+// proxyHandshake 在已连接到代理 hop 的 conn 上建立到 next 的隧道（失败时关闭 conn）
+func (c *Client) proxyHandshake(ctx context.Context, conn net.Conn, hop *url.URL, next string) (net.Conn, error) {
+	addr := proxyAddr(hop)
+
+	// 根据代理类型处理
+	switch hop.Scheme {
+	case "http":
+		// HTTP CONNECT 代理
+		return httpConnectProxy(conn, addr, next, hop.User)
+	case "https":
+		// 先与代理建立 TLS，再发送 CONNECT
+		conn, err := c.tlsToProxy(ctx, conn, hop.Hostname())
+		if err != nil {
+			return nil, err
+		}
+		return httpConnectProxy(conn, addr, next, hop.User)
+	case "socks5", "socks5h":
+		// SOCKS5 代理（socks5 本地解析目标域名，socks5h 由代理解析）
+		if hop.Scheme == "socks5" {
+			var err error
+			if next, err = c.resolveTargetAddr(ctx, next); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+		return socks5Connect(conn, addr, next, hop.User)
+	default:
+		conn.Close()
+		return nil, fmt.Errorf("不支持的代理协议: %s", hop.Scheme)
+	}
+}
+
+// tlsToProxy 与 HTTPS 代理建立 TLS 连接（校验代理证书，InsecureSkipVerify 与 RootCAs 同样适用于代理）
+func (c *Client) tlsToProxy(ctx context.Context, conn net.Conn, serverName string) (net.Conn, error) {
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         serverName,
+		RootCAs:            c.config.RootCAs,
+		InsecureSkipVerify: c.config.InsecureSkipVerify,
+		NextProtos:         []string{"http/1.1"},
+	})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("代理 TLS 握手失败: %w", err)
+	}
+	return tlsConn, nil
+}
+
+// resolveTargetAddr 在本地解析目标地址中的域名（socks5 语义，经 Config.Resolver 解析）
+func (c *Client) resolveTargetAddr(ctx context.Context, addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if net.ParseIP(host) != nil {
+		return addr, nil
+	}
+	ips, err := c.lookupHost(ctx, host, "")
+	if err != nil {
+		return "", err
+	}
+	// 优先使用 IPv4 地址
+	ip := ips[0]
+	for _, addr := range ips {
+		if net.ParseIP(addr).To4() != nil {
+			ip = addr
+			break
+		}
+	}
+	return net.JoinHostPort(ip, port), nil
+}
+
+// httpConnectProxy HTTP CONNECT 代理（user 不为空时发送 Proxy-Authorization: Basic）
+// 响应通过 http.ReadResponse 解析；响应头之后已读入缓冲区的数据由返回的连接继续交付
+func httpConnectProxy(conn net.Conn, proxyAddr, target string, user *url.Userinfo) (net.Conn, error) {
+	// 发送 CONNECT 请求
+	connectReq := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n", target, target)
+	if user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		connectReq += "Proxy-Authorization: Basic " + credentials + "\r\n"
+	}
+	connectReq += "\r\n"
+	if _, err := io.WriteString(conn, connectReq); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// 读取响应
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("读取代理CONNECT响应失败: %w", err)
+	}
+
+	// 检查响应状态
+	switch {
+	case resp.StatusCode == http.StatusProxyAuthRequired:
+		conn.Close()
+		return nil, &ProxyAuthRequiredError{Proxy: proxyAddr, Status: resp.Status, Authenticate: resp.Header.Values("Proxy-Authenticate")}
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		conn.Close()
+		return nil, &ProxyRefusedError{Proxy: proxyAddr, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// socks5Connect SOCKS5 代理连接（user 不为空时同时提供用户名/密码认证，RFC 1929）
+func socks5Connect(conn net.Conn, proxyAddr, target string, user *url.Userinfo) (net.Conn, error) {
+	if err := socks5Handshake(conn, proxyAddr, target, user); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// socks5Handshake 完成 SOCKS5 方法协商、认证与 CONNECT
+func socks5Handshake(conn net.Conn, proxyAddr, target string, user *url.Userinfo) error {
+	// 解析目标地址
+	host, portStr, err := net.SplitHostPort(target)
+	if err != nil {
+		return fmt.Errorf("无效的目标地址: %w", err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return fmt.Errorf("无效的目标端口: %s", portStr)
+	}
+
+	// SOCKS5 握手：无认证，有认证信息时同时提供用户名/密码认证
+	handshake := []byte{0x05, 0x01, 0x00}
+	if user != nil {
+		handshake = []byte{0x05, 0x02, 0x00, 0x02}
+	}
+	if _, err := conn.Write(handshake); err != nil {
+		return err
+	}
+
+	// 读取服务器选择的认证方式
+	response := make([]byte, 2)
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return fmt.Errorf("读取SOCKS5握手响应失败: %w", err)
+	}
+	switch {
+	case response[0] != 0x05:
+		return fmt.Errorf("SOCKS5握手失败: 无效的协议版本 %d", response[0])
+	case response[1] == 0x00:
+	case response[1] == 0x02 && user != nil:
+		if err := socks5Auth(conn, proxyAddr, user); err != nil {
+			return err
+		}
+	case response[1] == 0xff:
+		return &ProxyAuthRequiredError{Proxy: proxyAddr}
+	default:
+		return fmt.Errorf("SOCKS5握手失败: 代理选择了不支持的认证方式 0x%02x", response[1])
+	}
+
+	// 构建连接请求
+	connectReq := []byte{0x05, 0x01, 0x00} // VER, CMD, RSV
+
+	// 地址类型和地址
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			connectReq = append(connectReq, 0x01)
+			connectReq = append(connectReq, ip4...)
+		} else {
+			connectReq = append(connectReq, 0x04)
+			connectReq = append(connectReq, ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return fmt.Errorf("目标域名过长: %s", host)
+		}
+		connectReq = append(connectReq, 0x03, byte(len(host)))
+		connectReq = append(connectReq, host...)
+	}
+
+	// 端口
+	connectReq = binary.BigEndian.AppendUint16(connectReq, uint16(port))
+
+	// 发送连接请求
+	if _, err := conn.Write(connectReq); err != nil {
+		return err
+	}
+
+	// 读取响应：VER, REP, RSV, ATYP
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("读取SOCKS5连接响应失败: %w", err)
+	}
+	if reply[0] != 0x05 {
+		return fmt.Errorf("SOCKS5连接失败: 无效的协议版本 %d", reply[0])
+	}
+	if reply[1] != 0x00 {
+		return &SOCKS5Error{Proxy: proxyAddr, Code: reply[1]}
+	}
+
+	// 读取并丢弃绑定地址与端口
+	var addrLen int
+	switch reply[3] {
+	case 0x01: // IPv4
+		addrLen = net.IPv4len
+	case 0x04: // IPv6
+		addrLen = net.IPv6len
+	case 0x03: // 域名
+		size := make([]byte, 1)
+		if _, err := io.ReadFull(conn, size); err != nil {
+			return fmt.Errorf("读取SOCKS5绑定地址失败: %w", err)
+		}
+		addrLen = int(size[0])
+	default:
+		return fmt.Errorf("SOCKS5连接失败: 未知的绑定地址类型 %d", reply[3])
+	}
+	if _, err := io.ReadFull(conn, make([]byte, addrLen+2)); err != nil {
+		return fmt.Errorf("读取SOCKS5绑定地址失败: %w", err)
+	}
+	return nil
+}
+
+// socks5Auth SOCKS5 用户名/密码认证（RFC 1929）
+func socks5Auth(conn net.Conn, proxyAddr string, user *url.Userinfo) error {
+	username := user.Username()
+	password, _ := user.Password()
+	if len(username) == 0 || len(username) > 255 || len(password) > 255 {
+		return fmt.Errorf("SOCKS5认证失败: 用户名或密码长度无效")
+	}
+
+	req := make([]byte, 0, 3+len(username)+len(password))
+	req = append(req, 0x01, byte(len(username)))
+	req = append(req, username...)
+	req = append(req, byte(len(password)))
+	req = append(req, password...)
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("读取SOCKS5认证响应失败: %w", err)
+	}
+	if reply[1] != 0x00 {
+		return &ProxyAuthRequiredError{Proxy: proxyAddr}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package utls_client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RedirectPolicy 重定向策略
+type RedirectPolicy int
+
+const (
+	// RedirectFollow 跟随重定向，最多 Config.MaxRedirects 跳（默认）
+	RedirectFollow RedirectPolicy = iota
+	// RedirectSameHost 只跟随同一主机内的重定向，跨主机时返回 3xx 响应
+	RedirectSameHost
+	// RedirectNone 不跟随重定向，直接返回 3xx 响应
+	RedirectNone
+)
+
+// defaultMaxRedirects 默认最大重定向次数（与 net/http 一致）
+const defaultMaxRedirects = 10
+
+// ErrTooManyRedirects 重定向次数超过 Config.MaxRedirects
+var ErrTooManyRedirects = errors.New("重定向次数过多")
+
+// Redirect 重定向链中的一跳
+type Redirect struct {
+	// 本跳请求的 URL
+	URL string
+
+	// 本跳返回的状态码
+	StatusCode int
+
+	// 本跳返回的 Location（已解析为绝对 URL）
+	Location string
+}
+
+// roundTripResult 一次请求（含重定向）的结果
+type roundTripResult struct {
+	resp      *http.Response
+	remote    net.Addr // 承载最后一跳的连接的对端地址
+	redirects []Redirect
+	attempts  int // 按重试策略的尝试次数
+}
+
+// nextRedirect 按重定向策略构建下一跳请求（不跟随时返回 nil）
+// 方法与请求体的处理与 net/http 一致：301/302 的 POST 与 303 改为 GET，307/308 保留方法并重放请求体
+func (c *Client) nextRedirect(prev *http.Request, resp *http.Response, hops int) (*http.Request, error) {
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return nil, nil
+	}
+	loc := resp.Header.Get("Location")
+	if c.config.RedirectPolicy == RedirectNone || loc == "" {
+		return nil, nil
+	}
+
+	u, err := prev.URL.Parse(loc)
+	if err != nil {
+		return nil, fmt.Errorf("解析重定向地址失败: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, nil
+	}
+	sameHost := strings.EqualFold(u.Hostname(), prev.URL.Hostname())
+	if c.config.RedirectPolicy == RedirectSameHost && !sameHost {
+		return nil, nil
+	}
+	maxHops := c.config.MaxRedirects
+	if maxHops <= 0 {
+		maxHops = defaultMaxRedirects
+	}
+	if hops >= maxHops {
+		return nil, fmt.Errorf("%w（%d 次），最后一跳: %s", ErrTooManyRedirects, maxHops, u.Redacted())
+	}
+
+	method, keepBody := prev.Method, true
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound:
+		if method == http.MethodPost {
+			method, keepBody = http.MethodGet, false
+		}
+	case http.StatusSeeOther:
+		if method != http.MethodGet && method != http.MethodHead {
+			method = http.MethodGet
+		}
+		keepBody = false
+	}
+
+	next, err := http.NewRequestWithContext(prev.Context(), method, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建重定向请求失败: %w", err)
+	}
+	next.Header = prev.Header.Clone()
+	if keepBody && prev.Body != nil && prev.Body != http.NoBody {
+		// 请求体不可重放时不跟随，返回 3xx 响应（与 net/http 一致）
+		if prev.GetBody == nil {
+			return nil, nil
+		}
+		if next.Body, err = prev.GetBody(); err != nil {
+			return nil, fmt.Errorf("重建请求体失败: %w", err)
+		}
+		next.GetBody, next.ContentLength = prev.GetBody, prev.ContentLength
+	} else if !keepBody {
+		delHeader(next.Header, "Content-Type")
+		delHeader(next.Header, "Content-Length")
+	}
+
+	// Host 覆盖只对原主机有效；认证信息与手动设置的 Cookie 只发往原主机及其子域名
+	if prev.Host != "" && u.Host == prev.URL.Host {
+		next.Host = prev.Host
+	}
+	if !sameHost && !isSubdomain(u.Hostname(), prev.URL.Hostname()) {
+		for _, name := range []string{"Authorization", "Www-Authenticate", "Cookie", "Cookie2"} {
+			delHeader(next.Header, name)
+		}
+	}
+	if ref := refererFor(prev.URL, u); ref != "" && !hasHeader(next.Header, "Referer") {
+		next.Header.Set("Referer", ref)
+	}
+	return next, nil
+}
+
+// isSubdomain 判断 host 是否为 parent 的子域名
+func isSubdomain(host, parent string) bool {
+	return strings.HasSuffix(strings.ToLower(host), "."+strings.ToLower(parent))
+}
+
+// refererFor 重定向时的 Referer（去掉认证信息与片段；https 跳转到 http 时不发送）
+func refererFor(from, to *url.URL) string {
+	if from.Scheme == "https" && to.Scheme == "http" {
+		return ""
+	}
+	ref := *from
+	ref.User, ref.Fragment = nil, ""
+	return ref.String()
+}
+
+// discardBody 丢弃少量剩余响应体后关闭，便于连接复用
+func discardBody(resp *http.Response) {
+	io.CopyN(io.Discard, resp.Body, 4<<10)
+	resp.Body.Close()
+}
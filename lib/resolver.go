@@ -0,0 +1,358 @@
+package utls_client
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Resolver 域名解析器（*net.Resolver 即满足该接口）
+// 配置后直连目标、第一跳代理以及 socks5 代理的目标域名都通过它解析；SNI 与 Host 仍使用原域名
+type Resolver interface {
+	// LookupHost 返回 host 的地址列表，按优先顺序依次尝试
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// HostsResolver 静态 hosts 解析器，未命中的域名交给 fallback
+type HostsResolver struct {
+	hosts    map[string][]string
+	fallback Resolver
+}
+
+// NewHostsResolver 创建静态 hosts 解析器（域名不区分大小写，fallback 为 nil 时使用系统解析）
+func NewHostsResolver(hosts map[string][]string, fallback Resolver) (*HostsResolver, error) {
+	if fallback == nil {
+		fallback = net.DefaultResolver
+	}
+	r := &HostsResolver{hosts: make(map[string][]string, len(hosts)), fallback: fallback}
+	for host, addrs := range hosts {
+		for _, addr := range addrs {
+			if net.ParseIP(addr) == nil {
+				return nil, fmt.Errorf("hosts 中 %s 的地址无效: %s", host, addr)
+			}
+		}
+		r.hosts[normalizeHost(host)] = append([]string(nil), addrs...)
+	}
+	return r, nil
+}
+
+// LookupHost 实现 Resolver
+func (r *HostsResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if addrs, ok := r.hosts[normalizeHost(host)]; ok && len(addrs) > 0 {
+		return append([]string(nil), addrs...), nil
+	}
+	return r.fallback.LookupHost(ctx, host)
+}
+
+// DoHResolver DNS-over-HTTPS 解析器（RFC 8484），查询经 uTLS 客户端发出，与业务请求使用相同的 TLS 指纹
+type DoHResolver struct {
+	endpoint string
+	client   *Client
+	dns      dnsClient
+}
+
+// NewDoHResolver 创建 DoH 解析器，endpoint 如 "https://1.1.1.1/dns-query"
+// client 为 nil 时使用默认客户端；client 自身不能以该解析器解析 endpoint 的域名（否则循环解析），
+// 可使用 IP 形式的 endpoint 或为其单独配置 HostsResolver
+func NewDoHResolver(endpoint string, client *Client) *DoHResolver {
+	if client == nil {
+		client = NewClient(nil, &Config{Timeout: 10 * time.Second})
+	}
+	r := &DoHResolver{endpoint: endpoint, client: client}
+	r.dns.exchange = r.exchange
+	r.dns.zeroID = true
+	return r
+}
+
+// LookupHost 实现 Resolver
+func (r *DoHResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return r.dns.lookup(ctx, host)
+}
+
+// exchange 以 GET 方式发送 DNS 查询
+func (r *DoHResolver) exchange(ctx context.Context, query []byte) ([]byte, error) {
+	sep := "?"
+	if strings.Contains(r.endpoint, "?") {
+		sep = "&"
+	}
+	target := r.endpoint + sep + "dns=" + base64.RawURLEncoding.EncodeToString(query)
+	resp, err := r.client.DoContext(ctx, "GET", target, &RequestConfig{
+		Headers: map[string]string{"Accept": "application/dns-message"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("DoH 服务器返回 %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// DoTResolver DNS-over-TLS 解析器（RFC 7858），每次查询使用新的 TLS 连接
+type DoTResolver struct {
+	server    string
+	tlsConfig *tls.Config
+	timeout   time.Duration
+	dns       dnsClient
+}
+
+// NewDoTResolver 创建 DoT 解析器，server 如 "1.1.1.1:853"（未指定端口时使用 853）
+// tlsConfig 为 nil 时以 server 的主机名校验证书
+func NewDoTResolver(server string, tlsConfig *tls.Config) *DoTResolver {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(strings.Trim(server, "[]"), "853")
+	}
+	if tlsConfig == nil {
+		host, _, _ := net.SplitHostPort(server)
+		tlsConfig = &tls.Config{ServerName: host}
+	}
+	r := &DoTResolver{server: server, tlsConfig: tlsConfig, timeout: 10 * time.Second}
+	r.dns.exchange = r.exchange
+	return r
+}
+
+// LookupHost 实现 Resolver
+func (r *DoTResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return r.dns.lookup(ctx, host)
+}
+
+// exchange 通过 TLS 连接发送带 2 字节长度前缀的 DNS 消息
+func (r *DoTResolver) exchange(ctx context.Context, query []byte) ([]byte, error) {
+	dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: r.timeout}, Config: r.tlsConfig}
+	conn, err := dialer.DialContext(ctx, "tcp", r.server)
+	if err != nil {
+		return nil, fmt.Errorf("连接 DoT 服务器失败: %w", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(r.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	msg := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(query)), uint16(len(query)))
+	if _, err := conn.Write(append(msg, query...)); err != nil {
+		return nil, err
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// dnsClient DoH 与 DoT 共用的查询与按 TTL 缓存逻辑
+type dnsClient struct {
+	exchange func(ctx context.Context, query []byte) ([]byte, error)
+	zeroID   bool // 消息 ID 固定为 0（RFC 8484 建议，便于 HTTP 缓存）
+
+	mu    sync.Mutex
+	cache map[string]dnsCacheEntry
+}
+
+// dnsCacheEntry 缓存的解析结果
+type dnsCacheEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// lookup 查询 A 与 AAAA 记录（IPv4 在前）
+func (d *dnsClient) lookup(ctx context.Context, host string) ([]string, error) {
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+	host = normalizeHost(host)
+
+	d.mu.Lock()
+	entry, ok := d.cache[host]
+	d.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return append([]string(nil), entry.addrs...), nil
+	}
+
+	type result struct {
+		addrs []string
+		ttl   uint32
+		err   error
+	}
+	types := []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA}
+	results := make([]result, len(types))
+	var wg sync.WaitGroup
+	for i, qtype := range types {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i].addrs, results[i].ttl, results[i].err = d.query(ctx, host, qtype)
+		}()
+	}
+	wg.Wait()
+
+	var addrs []string
+	var ttl uint32
+	var firstErr error
+	for _, r := range results {
+		if r.err != nil {
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			continue
+		}
+		if len(r.addrs) > 0 && (ttl == 0 || r.ttl < ttl) {
+			ttl = r.ttl
+		}
+		addrs = append(addrs, r.addrs...)
+	}
+	if len(addrs) == 0 {
+		if firstErr != nil {
+			return nil, firstErr
+		}
+		return nil, fmt.Errorf("%s 没有地址记录", host)
+	}
+
+	if ttl > 0 {
+		d.mu.Lock()
+		if d.cache == nil {
+			d.cache = make(map[string]dnsCacheEntry)
+		}
+		d.cache[host] = dnsCacheEntry{addrs: addrs, expires: time.Now().Add(time.Duration(ttl) * time.Second)}
+		d.mu.Unlock()
+	}
+	return append([]string(nil), addrs...), nil
+}
+
+// query 发送单个类型的查询，返回地址与最小 TTL
+func (d *dnsClient) query(ctx context.Context, host string, qtype dnsmessage.Type) ([]string, uint32, error) {
+	name, err := dnsmessage.NewName(host + ".")
+	if err != nil {
+		return nil, 0, fmt.Errorf("无效的域名 %s: %w", host, err)
+	}
+	var id [2]byte
+	if !d.zeroID {
+		rand.Read(id[:])
+	}
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: binary.BigEndian.Uint16(id[:]), RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	query, err := msg.Pack()
+	if err != nil {
+		return nil, 0, fmt.Errorf("构建 DNS 查询失败: %w", err)
+	}
+
+	resp, err := d.exchange(ctx, query)
+	if err != nil {
+		return nil, 0, fmt.Errorf("DNS 查询失败: %w", err)
+	}
+	return parseDNSAnswer(resp, msg.Header.ID)
+}
+
+// parseDNSAnswer 解析 DNS 应答中的 A/AAAA 记录（id 不为 0 时校验消息 ID；DoH 服务器可能将 ID 置 0）
+func parseDNSAnswer(resp []byte, id uint16) ([]string, uint32, error) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(resp)
+	if err != nil {
+		return nil, 0, fmt.Errorf("解析 DNS 应答失败: %w", err)
+	}
+	if header.ID != id && header.ID != 0 {
+		return nil, 0, fmt.Errorf("DNS 应答 ID 不匹配")
+	}
+	switch header.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, 0, nil
+	default:
+		return nil, 0, fmt.Errorf("DNS 服务器返回 %s", header.RCode)
+	}
+	if err := parser.SkipAllQuestions(); err != nil {
+		return nil, 0, fmt.Errorf("解析 DNS 应答失败: %w", err)
+	}
+
+	var addrs []string
+	var ttl uint32
+	for {
+		rh, err := parser.AnswerHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("解析 DNS 应答失败: %w", err)
+		}
+		var ip net.IP
+		switch rh.Type {
+		case dnsmessage.TypeA:
+			r, err := parser.AResource()
+			if err != nil {
+				return nil, 0, fmt.Errorf("解析 DNS 应答失败: %w", err)
+			}
+			ip = r.A[:]
+		case dnsmessage.TypeAAAA:
+			r, err := parser.AAAAResource()
+			if err != nil {
+				return nil, 0, fmt.Errorf("解析 DNS 应答失败: %w", err)
+			}
+			ip = r.AAAA[:]
+		default:
+			// CNAME 等记录由递归服务器展开，只取地址记录
+			if err := parser.SkipAnswer(); err != nil {
+				return nil, 0, fmt.Errorf("解析 DNS 应答失败: %w", err)
+			}
+			continue
+		}
+		if len(addrs) == 0 || rh.TTL < ttl {
+			ttl = rh.TTL
+		}
+		addrs = append(addrs, ip.String())
+	}
+	return addrs, ttl, nil
+}
+
+// normalizeHost 统一域名的大小写与末尾的点
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// lookupHost 通过配置的解析器解析域名（未配置时使用系统解析）
+// localIP 不为空时只保留与其地址族相同的地址
+func (c *Client) lookupHost(ctx context.Context, host, localIP string) ([]string, error) {
+	resolver := c.config.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	addrs, err := resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, &Error{Stage: StageResolve, Addr: host, Err: err}
+	}
+
+	var wantV4, filter bool
+	if local := net.ParseIP(localIP); local != nil {
+		wantV4, filter = local.To4() != nil, true
+	}
+	ips := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		if ip == nil || (filter && (ip.To4() != nil) != wantV4) {
+			continue
+		}
+		ips = append(ips, ip.String())
+	}
+	if len(ips) == 0 {
+		return nil, &Error{Stage: StageResolve, Addr: host, Err: errors.New("没有可用的地址")}
+	}
+	return ips, nil
+}
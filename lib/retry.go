@@ -0,0 +1,397 @@
+package utls_client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+	"golang.org/x/net/http2"
+)
+
+// RetryErrorClass 可重试的错误类别（可按位组合）
+type RetryErrorClass int
+
+const (
+	// RetryOnDial TCP 连接、域名解析与代理握手失败（请求未发出）
+	RetryOnDial RetryErrorClass = 1 << iota
+	// RetryOnHandshake TLS 握手失败（请求未发出）
+	RetryOnHandshake
+	// RetryOnReset 连接被重置或意外关闭
+	RetryOnReset
+	// RetryOnGoAway HTTP/2 GOAWAY 或 REFUSED_STREAM
+	RetryOnGoAway
+	// RetryOnTimeout 连接或读写超时（不含 ctx 取消）
+	RetryOnTimeout
+
+	// RetryOnDefault 未设置 RetryOn 时使用的类别
+	RetryOnDefault = RetryOnDial | RetryOnHandshake | RetryOnReset | RetryOnGoAway
+)
+
+// RetryRotation 重试时更换的连接属性（可按位组合）
+type RetryRotation int
+
+const (
+	// RotateConnection 重试使用新建的连接（不复用连接池中的连接）
+	RotateConnection RetryRotation = 1 << iota
+	// RotateRemoteIP 重试使用新建的连接，并优先连接目标的其它 IP（需配置 Resolver 或 DialHappyEyeballs，且解析出多个地址）
+	RotateRemoteIP
+	// RotateFingerprint 重试依次使用 RetryPolicy.Fingerprints 中的指纹
+	RotateFingerprint
+)
+
+// RetryPolicy 重试策略
+// 配置了 SourcePool 时每次尝试本就使用池中的下一个源地址
+type RetryPolicy struct {
+	// 最大尝试次数（含首次请求），不大于 1 时不重试
+	MaxAttempts int
+
+	// 首次重试前的退避时间（默认 200ms），之后按 Multiplier 指数增长
+	InitialBackoff time.Duration
+
+	// 退避时间上限（默认 10s）
+	MaxBackoff time.Duration
+
+	// 退避倍数（默认 2）
+	Multiplier float64
+
+	// 抖动比例（0~1，默认 0.5）：实际退避在 [(1-Jitter)*d, d] 内随机
+	Jitter float64
+
+	// 需要重试的状态码（默认 429、500、502、503、504）
+	RetryOnStatus []int
+
+	// 需要重试的错误类别（默认 RetryOnDefault）
+	RetryOn RetryErrorClass
+
+	// 是否重试非幂等请求（如 POST）；默认只重试幂等方法或带 Idempotency-Key 头的请求，
+	// 请求未发出的错误（RetryOnDial、RetryOnHandshake）总是可以重试
+	RetryNonIdempotent bool
+
+	// 是否忽略响应的 Retry-After（默认按 Retry-After 等待：未设置 Budget 时最多等待 MaxBackoff，
+	// 超出 Budget 时不再重试）
+	IgnoreRetryAfter bool
+
+	// 整个请求（所有尝试、退避等待与读取响应体）的时间预算（0 表示不限制）
+	// 作为请求 ctx 的截止时间，进行中的尝试也不会超出；剩余预算不足以等待下一次重试时直接返回
+	Budget time.Duration
+
+	// 重试时更换的连接属性
+	Rotate RetryRotation
+
+	// RotateFingerprint 时依次使用的指纹（默认 Chrome、Firefox、Safari）
+	Fingerprints []utls.ClientHelloID
+}
+
+// 默认重试参数
+var (
+	defaultRetryStatus       = []int{http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	defaultRetryFingerprints = []utls.ClientHelloID{utls.HelloChrome_133, utls.HelloFirefox_120, utls.HelloSafari_Auto}
+)
+
+// backoff 第 retry 次重试（从 1 开始）前的退避时间
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	initial, maxBackoff, multiplier, jitter := p.InitialBackoff, p.maxBackoff(), p.Multiplier, p.Jitter
+	if initial <= 0 {
+		initial = 200 * time.Millisecond
+	}
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	if jitter <= 0 || jitter > 1 {
+		jitter = 0.5
+	}
+	d := math.Min(float64(initial)*math.Pow(multiplier, float64(retry-1)), float64(maxBackoff))
+	return time.Duration(d * (1 - jitter*rand.Float64()))
+}
+
+// maxBackoff 退避时间上限
+func (p *RetryPolicy) maxBackoff() time.Duration {
+	if p.MaxBackoff <= 0 {
+		return 10 * time.Second
+	}
+	return p.MaxBackoff
+}
+
+// retryStatus 判断状态码是否需要重试
+func (p *RetryPolicy) retryStatus(code int) bool {
+	statuses := p.RetryOnStatus
+	if statuses == nil {
+		statuses = defaultRetryStatus
+	}
+	return slices.Contains(statuses, code)
+}
+
+// fingerprint 第 retry 次重试使用的指纹
+func (p *RetryPolicy) fingerprint(retry int) utls.ClientHelloID {
+	fingerprints := p.Fingerprints
+	if len(fingerprints) == 0 {
+		fingerprints = defaultRetryFingerprints
+	}
+	return fingerprints[(retry-1)%len(fingerprints)]
+}
+
+// classifyError 返回错误所属的重试类别（0 表示不可重试）
+func classifyError(err error) RetryErrorClass {
+	var goAway http2.GoAwayError
+	var streamErr http2.StreamError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return 0
+	case errors.Is(err, ErrTLSHandshake):
+		return RetryOnHandshake
+	case errors.Is(err, ErrResolve), errors.Is(err, ErrConnect), errors.Is(err, ErrProxy):
+		return RetryOnDial
+	case errors.As(err, &goAway),
+		errors.As(err, &streamErr) && streamErr.Code == http2.ErrCodeRefusedStream:
+		return RetryOnGoAway
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE),
+		errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return RetryOnReset
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return RetryOnTimeout
+	}
+	return 0
+}
+
+// idempotent 判断请求能否安全重放（幂等方法或带 Idempotency-Key 头）
+func idempotent(method string, req *RequestConfig) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	for k := range req.Headers {
+		if strings.EqualFold(k, "Idempotency-Key") {
+			return true
+		}
+	}
+	for _, f := range req.OrderedHeaders {
+		if strings.EqualFold(f.Name, "Idempotency-Key") {
+			return true
+		}
+	}
+	return false
+}
+
+// retryAfter 解析 Retry-After（秒数或 HTTP 日期）
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// replayableBody 返回可在每次尝试前回到起始位置的请求体（不可重放时 ok 为 false）
+// *bytes.Buffer 转为 *bytes.Reader；其余 io.ReadSeeker 隐藏 Close，避免首次尝试后被传输层关闭
+func replayableBody(body io.Reader) (replay io.Reader, rewind func() error, ok bool) {
+	switch b := body.(type) {
+	case nil:
+		return nil, func() error { return nil }, true
+	case *bytes.Buffer:
+		body = bytes.NewReader(b.Bytes())
+	case *bytes.Reader, *strings.Reader:
+	case io.ReadSeeker:
+		body = struct{ io.ReadSeeker }{b}
+	default:
+		return nil, nil, false
+	}
+	seeker := body.(io.Seeker)
+	offset, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, nil, false
+	}
+	return body, func() error {
+		_, err := seeker.Seek(offset, io.SeekStart)
+		return err
+	}, true
+}
+
+// retryDial 重试时的拨号要求（经 ctx 传给 roundTrip 与 dialTCP）
+type retryDial struct {
+	fresh bool     // 使用新建的连接
+	avoid []string // 尽量避开的目标 IP
+}
+
+// retryDialKey retryDial 在 ctx 中的键
+type retryDialKey struct{}
+
+// retryDialFrom 取出 ctx 中的重试拨号要求
+func retryDialFrom(ctx context.Context) retryDial {
+	rd, _ := ctx.Value(retryDialKey{}).(retryDial)
+	return rd
+}
+
+// failedIP 返回出错的对端 IP（错误未记录对端 IP 时为空）
+func failedIP(err error) string {
+	var e *Error
+	if !errors.As(err, &e) {
+		return ""
+	}
+	host, _, splitErr := net.SplitHostPort(e.Addr)
+	if splitErr != nil || net.ParseIP(host) == nil {
+		return ""
+	}
+	return host
+}
+
+// cancelOnClose 响应体关闭时释放 ctx
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// avoidIPs 将需要避开的地址移到末尾（保持其余地址的顺序）
+func avoidIPs(ips, avoid []string) []string {
+	if len(avoid) == 0 {
+		return ips
+	}
+	preferred := make([]string, 0, len(ips))
+	var avoided []string
+	for _, ip := range ips {
+		if slices.Contains(avoid, ip) {
+			avoided = append(avoided, ip)
+		} else {
+			preferred = append(preferred, ip)
+		}
+	}
+	return append(preferred, avoided...)
+}
+
+// roundTripWithRetry 按重试策略发送请求（RequestConfig.RetryPolicy 优先于 Config.RetryPolicy）
+func (c *Client) roundTripWithRetry(ctx context.Context, method, target string, req *RequestConfig) (result *roundTripResult, err error) {
+	policy := req.RetryPolicy
+	if policy == nil {
+		policy = c.config.RetryPolicy
+	}
+	if policy == nil || policy.MaxAttempts <= 1 {
+		return c.roundTrip(ctx, method, target, req)
+	}
+	body, rewind, ok := replayableBody(req.Body)
+	if !ok {
+		// 请求体不可重放，只尝试一次
+		return c.roundTrip(ctx, method, target, req)
+	}
+	retryOn := policy.RetryOn
+	if retryOn == 0 {
+		retryOn = RetryOnDefault
+	}
+	if policy.Budget > 0 {
+		// 预算作为截止时间，成功时在响应体关闭后释放
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, policy.Budget)
+		defer func() {
+			if err != nil || result == nil {
+				cancel()
+				return
+			}
+			result.resp.Body = cancelOnClose{ReadCloser: result.resp.Body, cancel: cancel}
+		}()
+	}
+
+	attemptReq := *req
+	attemptReq.Body = body
+	start := time.Now()
+	var avoid []string
+	for attempt := 1; ; attempt++ {
+		attemptCtx := ctx
+		if attempt > 1 {
+			if err := rewind(); err != nil {
+				return nil, fmt.Errorf("重放请求体失败: %w", err)
+			}
+			if policy.Rotate&RotateFingerprint != 0 {
+				fp := policy.fingerprint(attempt - 1)
+				attemptReq.Fingerprint = &fp
+			}
+			if policy.Rotate&(RotateConnection|RotateRemoteIP) != 0 {
+				attemptCtx = context.WithValue(ctx, retryDialKey{}, retryDial{fresh: true, avoid: avoid})
+			}
+		}
+
+		result, err := c.roundTrip(attemptCtx, method, target, &attemptReq)
+		if err == nil {
+			result.attempts = attempt
+		}
+		if attempt >= policy.MaxAttempts || ctx.Err() != nil {
+			return result, withAttempts(err, attempt)
+		}
+
+		// 判断是否重试以及等待时间
+		var wait time.Duration
+		if err != nil {
+			class := classifyError(err)
+			safe := class&(RetryOnDial|RetryOnHandshake) != 0
+			if class&retryOn == 0 || !(safe || policy.RetryNonIdempotent || idempotent(method, req)) {
+				return nil, withAttempts(err, attempt)
+			}
+			wait = policy.backoff(attempt)
+			if policy.Budget > 0 && time.Since(start)+wait > policy.Budget {
+				return nil, withAttempts(err, attempt)
+			}
+			if ip := failedIP(err); ip != "" && policy.Rotate&RotateRemoteIP != 0 {
+				avoid = append(avoid, ip)
+			}
+		} else {
+			resp := result.resp
+			if !policy.retryStatus(resp.StatusCode) || !(policy.RetryNonIdempotent || idempotent(method, req)) {
+				return result, nil
+			}
+			wait = policy.backoff(attempt)
+			if after, ok := retryAfter(resp); ok && !policy.IgnoreRetryAfter {
+				wait = after
+				if policy.Budget <= 0 {
+					wait = min(wait, policy.maxBackoff())
+				}
+			}
+			if policy.Budget > 0 && time.Since(start)+wait > policy.Budget {
+				return result, nil
+			}
+			if policy.Rotate&RotateRemoteIP != 0 && result.remote != nil {
+				if host, _, err := net.SplitHostPort(result.remote.String()); err == nil {
+					avoid = append(avoid, host)
+				}
+			}
+			discardBody(resp)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// withAttempts 在多次尝试后失败的错误中注明尝试次数
+func withAttempts(err error, attempts int) error {
+	if err == nil || attempts <= 1 {
+		return err
+	}
+	return fmt.Errorf("%w（共尝试 %d 次）", err, attempts)
+}
@@ -0,0 +1,116 @@
+package utls_client
+
+import (
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+)
+
+// IPCandidate 选择器看到的候选 IP（已排除隔离中的 IP）
+type IPCandidate struct {
+	// 远端 IP（ConnPoolManager.Do 传入的主机带端口时为 ip:port）
+	IP string
+
+	// 健康得分（0~1，按滚动成功率与连续失败次数计算；探测中的 IP 得分较低）
+	Score float64
+
+	// 进行中的请求数
+	InFlight int
+
+	// 成功请求延迟的指数移动平均（尚无样本时为 0）
+	Latency time.Duration
+}
+
+// Selector ConnPoolManager 在只给出主机名时选择远端 IP 的策略
+// key 为请求的分片键（RequestConfig.ShardKey，未设置时为请求路径）；candidates 非空，返回选中的下标
+type Selector interface {
+	Select(key string, candidates []IPCandidate) int
+}
+
+// SelectorFunc 函数形式的 Selector
+type SelectorFunc func(key string, candidates []IPCandidate) int
+
+func (f SelectorFunc) Select(key string, candidates []IPCandidate) int {
+	return f(key, candidates)
+}
+
+// NewRoundRobinSelector 轮询选择（默认）
+func NewRoundRobinSelector() Selector {
+	var next atomic.Uint64
+	return SelectorFunc(func(_ string, candidates []IPCandidate) int {
+		return int((next.Add(1) - 1) % uint64(len(candidates)))
+	})
+}
+
+// NewWeightedRandomSelector 按健康得分加权随机选择
+func NewWeightedRandomSelector() Selector {
+	return SelectorFunc(func(_ string, candidates []IPCandidate) int {
+		// 得分为 0 的 IP 保留极小的权重，避免全部为 0 时无法选择
+		const minWeight = 0.01
+		total := 0.0
+		for _, c := range candidates {
+			total += max(c.Score, minWeight)
+		}
+		r := rand.Float64() * total
+		for i, c := range candidates {
+			if r -= max(c.Score, minWeight); r < 0 {
+				return i
+			}
+		}
+		return len(candidates) - 1
+	})
+}
+
+// NewLeastInFlightSelector 选择进行中请求最少的 IP（相同时随机）
+func NewLeastInFlightSelector() Selector {
+	return SelectorFunc(func(_ string, candidates []IPCandidate) int {
+		best, ties := 0, 1
+		for i := 1; i < len(candidates); i++ {
+			switch {
+			case candidates[i].InFlight < candidates[best].InFlight:
+				best, ties = i, 1
+			case candidates[i].InFlight == candidates[best].InFlight:
+				// 蓄水池抽样，在并列的 IP 中均匀随机
+				if ties++; rand.IntN(ties) == 0 {
+					best = i
+				}
+			}
+		}
+		return best
+	})
+}
+
+// NewP2CSelector 二选一（power of two choices）：随机取两个 IP，选择延迟较低者；
+// 尚无延迟样本的 IP 视为最快以便获得样本，延迟相同时选择进行中请求较少者
+func NewP2CSelector() Selector {
+	return SelectorFunc(func(_ string, candidates []IPCandidate) int {
+		if len(candidates) == 1 {
+			return 0
+		}
+		a := rand.IntN(len(candidates))
+		b := rand.IntN(len(candidates) - 1)
+		if b >= a {
+			b++
+		}
+		ca, cb := candidates[a], candidates[b]
+		if cb.Latency < ca.Latency || (cb.Latency == ca.Latency && cb.InFlight < ca.InFlight) {
+			return b
+		}
+		return a
+	})
+}
+
+// NewConsistentHashSelector 按分片键一致性哈希（最高随机权重哈希）选择：
+// 同一键固定落在同一 IP，便于利用上游缓存；IP 被隔离或增减时只迁移受影响的键
+func NewConsistentHashSelector() Selector {
+	return SelectorFunc(func(key string, candidates []IPCandidate) int {
+		best := 0
+		var bestScore uint64
+		for i, c := range candidates {
+			if score := hrwScore(key, c.IP); i == 0 || score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		return best
+	})
+}
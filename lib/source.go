@@ -0,0 +1,141 @@
+package utls_client
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// SourcePool 本地源地址池
+// 列表模式按顺序轮换配置的地址；前缀模式在给定网段内生成随机地址（如 IPv6 /64）
+type SourcePool struct {
+	mu     sync.Mutex
+	addrs  []net.IP
+	next   int
+	prefix *net.IPNet
+}
+
+// NewSourcePool 创建轮换使用给定地址的源地址池
+func NewSourcePool(addrs []string) (*SourcePool, error) {
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("源地址列表为空")
+	}
+	pool := &SourcePool{addrs: make([]net.IP, 0, len(addrs))}
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return nil, fmt.Errorf("无效的源地址: %s", addr)
+		}
+		pool.addrs = append(pool.addrs, ip)
+	}
+	return pool, nil
+}
+
+// NewPrefixSourcePool 创建在网段内生成随机源地址的地址池（cidr 如 "2001:db8:1:2::/64"）
+// size > 0 时预先生成 size 个不重复的随机地址并轮换使用（连接可复用）；
+// size 为 0 时每个请求使用新的随机地址，连接只用于一次请求
+func NewPrefixSourcePool(cidr string, size int) (*SourcePool, error) {
+	_, prefix, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("无效的网段: %w", err)
+	}
+	ones, bits := prefix.Mask.Size()
+	if bits-ones < 2 {
+		return nil, fmt.Errorf("网段 %s 过小", cidr)
+	}
+	if size < 0 {
+		return nil, fmt.Errorf("无效的地址数量: %d", size)
+	}
+	if hostBits := bits - ones; hostBits < 31 && size > 1<<hostBits-2 {
+		return nil, fmt.Errorf("网段 %s 容纳不下 %d 个地址", cidr, size)
+	}
+
+	pool := &SourcePool{prefix: prefix}
+	seen := make(map[string]bool, size)
+	for len(pool.addrs) < size {
+		ip, err := randomIPInPrefix(prefix)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[ip.String()] {
+			seen[ip.String()] = true
+			pool.addrs = append(pool.addrs, ip)
+		}
+	}
+	return pool, nil
+}
+
+// Next 返回下一个源地址
+func (p *SourcePool) Next() (net.IP, error) {
+	if p.ephemeral() {
+		return randomIPInPrefix(p.prefix)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ip := p.addrs[p.next%len(p.addrs)]
+	p.next++
+	return ip, nil
+}
+
+// ephemeral 每次返回新的随机地址（此时不缓存按源地址区分的传输层）
+func (p *SourcePool) ephemeral() bool {
+	return p.prefix != nil && len(p.addrs) == 0
+}
+
+// randomIPInPrefix 在网段内生成随机地址（主机位不全为 0 或全为 1）
+func randomIPInPrefix(prefix *net.IPNet) (net.IP, error) {
+	base := prefix.IP
+	ip := make(net.IP, len(base))
+	for {
+		if _, err := rand.Read(ip); err != nil {
+			return nil, fmt.Errorf("生成随机地址失败: %w", err)
+		}
+		allZero, allOnes := true, true
+		for i := range ip {
+			host := ip[i] &^ prefix.Mask[i]
+			allZero = allZero && host == 0
+			allOnes = allOnes && host == ^prefix.Mask[i]
+			ip[i] = base[i]&prefix.Mask[i] | host
+		}
+		if !allZero && !allOnes {
+			return ip, nil
+		}
+	}
+}
+
+// sourceAddr 确定本次请求的本地源地址
+// 优先级：请求级 LocalIP > Config.SourcePool > Config.LocalIP；ephemeral 表示地址为一次性随机地址
+func (c *Client) sourceAddr(req *RequestConfig) (localIP string, ephemeral bool, err error) {
+	switch {
+	case req.LocalIP != "":
+		localIP = req.LocalIP
+	case c.config.SourcePool != nil:
+		ip, err := c.config.SourcePool.Next()
+		if err != nil {
+			return "", false, err
+		}
+		return ip.String(), c.config.SourcePool.ephemeral(), nil
+	default:
+		localIP = c.config.LocalIP
+	}
+
+	if localIP == "" {
+		return "", false, nil
+	}
+	ip := net.ParseIP(localIP)
+	if ip == nil {
+		return "", false, fmt.Errorf("无效的本地源地址: %s", localIP)
+	}
+	return ip.String(), false, nil
+}
+
+// newDialer 创建绑定本地源地址的拨号器（localIP 为空时由系统选择）
+func (c *Client) newDialer(localIP string) *net.Dialer {
+	dialer := &net.Dialer{Timeout: c.config.Timeout}
+	if ip := net.ParseIP(localIP); ip != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+	return dialer
+}
@@ -0,0 +1,226 @@
+package utls_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// ErrBodyTooLarge 响应体超过 MaxBodyBytes 限制
+var ErrBodyTooLarge = errors.New("响应体超过大小限制")
+
+// ProgressFunc 响应体读取进度回调
+// read 为已读取字节数，total 为 Content-Length（未知时为 -1）
+type ProgressFunc func(read, total int64)
+
+// StreamResponse 流式响应：响应体不缓冲到内存，由调用方边读边处理
+type StreamResponse struct {
+	// HTTP 状态码
+	StatusCode int
+
+	// 状态文本
+	Status string
+
+	// 响应头（每个头部仅保留第一个值）
+	Headers map[string]string
+
+	// 完整响应头
+	Header http.Header
+
+	// HTTP 版本
+	HTTPVersion string
+
+	// 响应体长度（未知时为 -1；自动解码后为 -1）
+	ContentLength int64
+
+	// 原始 Content-Encoding（自动解码后响应头中的 Content-Encoding 已被移除）
+	ContentEncoding string
+
+	// 响应体流（受大小限制与进度回调约束），调用方必须 Close
+	Body io.ReadCloser
+
+	// 原始标准响应（可读取 TLS 状态、请求信息等元数据；请勿直接读取 Raw.Body）
+	Raw *http.Response
+
+	// 承载本次请求的连接的对端地址（经代理时为第一跳代理的地址）
+	RemoteAddr string
+
+	// 对端地址族（FamilyIPv4 或 FamilyIPv6）
+	AddressFamily string
+
+	// 最终响应对应的 URL（跟随重定向后）
+	URL string
+
+	// 重定向链（按顺序，不含最终响应）
+	Redirects []Redirect
+
+	// 尝试次数（含首次请求，未重试时为 1）
+	Attempts int
+
+	reader *bodyReader
+}
+
+// Trailer 返回响应尾部，仅在 Body 读取到 EOF 之后完整
+func (r *StreamResponse) Trailer() http.Header {
+	return r.Raw.Trailer
+}
+
+// CompressedSize 返回目前已从连接读取的（解码前）字节数
+func (r *StreamResponse) CompressedSize() int64 {
+	return r.reader.wire.n
+}
+
+// UncompressedSize 返回目前已读取的（解码后）字节数
+func (r *StreamResponse) UncompressedSize() int64 {
+	return r.reader.read
+}
+
+// Close 关闭响应体
+func (r *StreamResponse) Close() error {
+	return r.Body.Close()
+}
+
+// DoStream 发送 HTTP 请求并以流的形式返回响应体
+// 适合大文件（如 RockTree 纹理、IP 池 JSON）直接写入磁盘或转发到 gRPC 流；
+// 注意 Config.Timeout 同样约束整个读取过程，长时间传输请通过 ctx 控制
+func (c *Client) DoStream(ctx context.Context, method, target string, req *RequestConfig) (*StreamResponse, error) {
+	if req == nil {
+		req = &RequestConfig{}
+	}
+	if err := c.life.begin(); err != nil {
+		return nil, err
+	}
+
+	result, err := c.roundTripWithRetry(ctx, method, target, req)
+	if err != nil {
+		c.life.end()
+		return nil, err
+	}
+	resp := result.resp
+
+	body, err := c.newBodyReader(resp, req)
+	if err != nil {
+		c.life.end()
+		return nil, err
+	}
+	body.onClose = c.life.end
+
+	remoteAddr, family := remoteFamily(result.remote)
+	return &StreamResponse{
+		StatusCode:      resp.StatusCode,
+		Status:          resp.Status,
+		Headers:         flattenHeaders(resp.Header),
+		Header:          resp.Header,
+		HTTPVersion:     httpVersionOf(resp),
+		ContentLength:   resp.ContentLength,
+		ContentEncoding: body.encoding,
+		Body:            body,
+		Raw:             resp,
+		RemoteAddr:      remoteAddr,
+		AddressFamily:   family,
+		URL:             resp.Request.URL.String(),
+		Redirects:       result.redirects,
+		Attempts:        result.attempts,
+		reader:          body,
+	}, nil
+}
+
+// GetStream 以流的形式发送 GET 请求
+func (c *Client) GetStream(ctx context.Context, target string, headers map[string]string) (*StreamResponse, error) {
+	return c.DoStream(ctx, "GET", target, &RequestConfig{
+		Method:  "GET",
+		Headers: headers,
+	})
+}
+
+// newBodyReader 包装响应体：按配置自动解码，并应用大小限制与进度回调
+// 大小限制与进度均按解码后的字节计算；未解码且 Content-Length 已知超过限制时直接关闭响应体并返回错误
+func (c *Client) newBodyReader(resp *http.Response, req *RequestConfig) (*bodyReader, error) {
+	limit := c.config.MaxBodyBytes
+	if req.MaxBodyBytes > 0 {
+		limit = req.MaxBodyBytes
+	}
+
+	wire := &countingReader{r: resp.Body}
+	b := &bodyReader{
+		r:        wire,
+		closer:   resp.Body,
+		wire:     wire,
+		total:    resp.ContentLength,
+		limit:    limit,
+		progress: req.OnProgress,
+	}
+
+	if resp.Header != nil {
+		b.encoding = resp.Header.Get("Content-Encoding")
+	}
+	if c.config.AutoDecompress && b.encoding != "" {
+		decoded, err := decodeResponseBody(resp, wire)
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		if decoded != nil {
+			// 解码后长度未知
+			b.r, b.closer, b.total = decoded, decoded, -1
+		}
+	}
+
+	if limit > 0 && b.total > limit {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: Content-Length %d 超过限制 %d 字节", ErrBodyTooLarge, b.total, limit)
+	}
+
+	return b, nil
+}
+
+// bodyReader 带自动解码、大小限制与进度回调的响应体读取器
+type bodyReader struct {
+	r        io.Reader
+	closer   io.Closer
+	wire     *countingReader // 线上（解码前）字节计数
+	encoding string          // 原始 Content-Encoding
+	read     int64
+	total    int64
+	limit    int64
+	progress ProgressFunc
+
+	// onClose 首次关闭时调用（流式响应借此结束客户端的进行中请求计数）
+	onClose   func()
+	closeOnce sync.Once
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	// 多读 1 字节用于判断是否超限
+	if b.limit > 0 {
+		if remain := b.limit - b.read + 1; int64(len(p)) > remain {
+			p = p[:remain]
+		}
+	}
+
+	n, err := b.r.Read(p)
+	if b.limit > 0 && b.read+int64(n) > b.limit {
+		n = int(b.limit - b.read)
+		err = fmt.Errorf("%w: 已读取超过 %d 字节", ErrBodyTooLarge, b.limit)
+	}
+
+	b.read += int64(n)
+	if b.progress != nil && n > 0 {
+		b.progress(b.read, b.total)
+	}
+	if err != nil && err != io.EOF {
+		err = &Error{Stage: StageBody, Err: err}
+	}
+	return n, err
+}
+
+func (b *bodyReader) Close() error {
+	err := b.closer.Close()
+	if b.onClose != nil {
+		b.closeOnce.Do(b.onClose)
+	}
+	return err
+}
@@ -0,0 +1,127 @@
+package utls_client
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+// ErrPinMismatch 证书链中没有与 Config.PinnedKeys 匹配的公钥
+var ErrPinMismatch = errors.New("证书公钥与固定值不匹配")
+
+// CertVerifyFunc 自定义证书校验回调
+// host 为校验使用的主机名；chain 为证书链（叶证书在前），启用链校验时为校验通过的链，否则为服务器发送的证书
+type CertVerifyFunc func(host string, chain []*x509.Certificate) error
+
+// LoadRootCAs 从 PEM 文件加载根证书（每个文件可包含多个证书）
+// 返回的证书池只包含这些证书；需要同时信任系统根证书时，可对 x509.SystemCertPool() 的结果调用 AppendCertsFromPEM
+func LoadRootCAs(paths ...string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("读取根证书失败: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("文件 %s 中没有 PEM 证书", path)
+		}
+	}
+	return pool, nil
+}
+
+// SPKIHash 返回证书公钥（SubjectPublicKeyInfo）SHA-256 的 Base64，即 Config.PinnedKeys 使用的格式
+func SPKIHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// verifyHostname 校验证书使用的主机名：Config.VerifyHostname 优先，否则与 SNI 一致
+func (c *Client) verifyHostname(sni string) string {
+	if c.config.VerifyHostname != "" {
+		return c.config.VerifyHostname
+	}
+	return sni
+}
+
+// verifyConnection 返回 uTLS 的 VerifyConnection 回调
+// 证书校验由本客户端完成（uTLS 的内置校验始终关闭），使校验主机名可以与 SNI 不同，并支持公钥固定与自定义回调
+func (c *Client) verifyConnection(host string) func(utls.ConnectionState) error {
+	return func(state utls.ConnectionState) error {
+		return c.verifyPeer(host, state.PeerCertificates)
+	}
+}
+
+// verifyPeer 依次进行证书链与主机名校验（InsecureSkipVerify 时跳过）、公钥固定与自定义回调
+func (c *Client) verifyPeer(host string, certs []*x509.Certificate) error {
+	if len(certs) == 0 {
+		return errors.New("服务器未提供证书")
+	}
+
+	chains := [][]*x509.Certificate{certs}
+	if !c.config.InsecureSkipVerify {
+		opts := x509.VerifyOptions{
+			Roots:         c.config.RootCAs,
+			DNSName:       host,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range certs[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		verified, err := certs[0].Verify(opts)
+		if err != nil {
+			return fmt.Errorf("校验 %s 的证书失败: %w", host, err)
+		}
+		chains = verified
+	}
+
+	if pins := c.pinsFor(host); len(pins) > 0 && !matchPins(pins, certs, chains) {
+		return fmt.Errorf("%w: %s", ErrPinMismatch, host)
+	}
+
+	if c.config.VerifyCertificate != nil {
+		return c.config.VerifyCertificate(host, chains[0])
+	}
+	return nil
+}
+
+// pinsFor 返回主机的固定公钥（精确匹配优先，其次为最长的 "*.域名" 匹配）
+func (c *Client) pinsFor(host string) []string {
+	if len(c.config.PinnedKeys) == 0 {
+		return nil
+	}
+	host = normalizeHost(host)
+	var pins []string
+	longest := -1
+	for pattern, keys := range c.config.PinnedKeys {
+		pattern = normalizeHost(pattern)
+		if pattern == host {
+			return keys
+		}
+		if parent, ok := strings.CutPrefix(pattern, "*."); ok && isSubdomain(host, parent) && len(parent) > longest {
+			pins, longest = keys, len(parent)
+		}
+	}
+	return pins
+}
+
+// matchPins 判断服务器证书或校验通过的链中是否有公钥与固定值匹配
+func matchPins(pins []string, certs []*x509.Certificate, chains [][]*x509.Certificate) bool {
+	want := make(map[string]bool, len(pins))
+	for _, pin := range pins {
+		want[strings.TrimPrefix(pin, "sha256/")] = true
+	}
+	for _, chain := range append(chains, certs) {
+		for _, cert := range chain {
+			if want[SPKIHash(cert)] {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -2,12 +2,15 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"net"
 	"os"
 	"os/exec"
+	"os/signal"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"utls_client/ippool"
@@ -54,6 +57,8 @@ func main() {
 	fmt.Println()
 	// 构建全局连接池管理器（长连常驻）
 	connMgr = clientLib.NewConnPoolManager(utls.HelloChrome_133, &clientLib.Config{Timeout: 30 * time.Second, ServerName: "kh.google.com"})
+	// 常驻连接在服务端发送 GOAWAY 前错开轮换
+	connMgr.SetMaxConnAge(45*time.Minute, 10*time.Minute)
 	// 测试：从环境变量注入黑名单
 	seedBlacklistFromEnv(lib, "kh.google.com")
 	fmt.Println("=== 首次预热 kh.google.com IPv6 长连接（仅白名单） ===")
@@ -84,7 +89,17 @@ func main() {
 	}()
 
 	fmt.Println("\n✅ 自检完成，长连接常驻：仅在请求403时移出池；黑名单每20分钟健康检查，200后再加入池。按 Ctrl+C 退出。")
-	select {}
+
+	// 收到退出信号后排空连接池（等待进行中的请求结束）再退出
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+	fmt.Println("\n正在排空连接池...")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := connMgr.Drain(ctx); err != nil {
+		fmt.Printf("排空连接池未完成: %v\n", err)
+	}
 }
 
 // 全局长连接池管理器
@@ -334,8 +349,6 @@ func initialWarmup(lib *ippool.IPPoolLibrary, host string, ipv6 bool) {
 	}
 	connMgr.WarmUp(allowed)
 
-	fp := utls.HelloChrome_133
-	conf := &clientLib.Config{Timeout: 30 * time.Second, ServerName: host}
 	sem := make(chan struct{}, 64)
 	var wg sync.WaitGroup
 	success := int64(0)
@@ -345,18 +358,8 @@ func initialWarmup(lib *ippool.IPPoolLibrary, host string, ipv6 bool) {
 		go func(targetIP string) {
 			defer wg.Done()
 			defer func() { <-sem }()
-			c, ok := connMgr.Get(targetIP)
-			if !ok {
-				c = clientLib.NewClient(&fp, conf)
-				connMgr.WarmUp([]string{targetIP})
-			}
-			var url string
-			if ipv6 {
-				url = fmt.Sprintf("https://[%s]/rt/earth/PlanetoidMetadata", targetIP)
-			} else {
-				url = fmt.Sprintf("https://%s/rt/earth/PlanetoidMetadata", targetIP)
-			}
-			resp, err := c.Do("GET", url, &clientLib.RequestConfig{Method: "GET", Headers: map[string]string{"Host": host, "Accept-Encoding": "gzip", "User-Agent": "Mozilla/5.0"}, Host: host})
+			// 请求走 connMgr 中该 IP 的常驻连接（没有时由 Do 建立）
+			resp, err := connMgr.Do(context.Background(), targetIP, &clientLib.RequestConfig{Method: "GET", Path: "/rt/earth/PlanetoidMetadata", Headers: map[string]string{"Accept-Encoding": "gzip", "User-Agent": "Mozilla/5.0"}, Host: host})
 			if err == nil && resp != nil && resp.StatusCode == 200 {
 				success++
 				lib.ReportStatus(host, targetIP, 200)
@@ -364,6 +367,9 @@ func initialWarmup(lib *ippool.IPPoolLibrary, host string, ipv6 bool) {
 			if err == nil && resp != nil && resp.StatusCode == 403 {
 				lib.ReportStatus(host, targetIP, 403)
 			}
+			if err != nil {
+				lib.ReportError(host, targetIP, err)
+			}
 		}(ip)
 	}
 	wg.Wait()
@@ -398,8 +404,6 @@ func checkBlacklisted(lib *ippool.IPPoolLibrary, host string, ipv6 bool) {
 		return
 	}
 
-	fp := utls.HelloChrome_133
-	conf := &clientLib.Config{Timeout: 30 * time.Second, ServerName: host}
 	sem := make(chan struct{}, 32)
 	var wg sync.WaitGroup
 	unbanned := int64(0)
@@ -409,18 +413,8 @@ func checkBlacklisted(lib *ippool.IPPoolLibrary, host string, ipv6 bool) {
 		go func(targetIP string) {
 			defer wg.Done()
 			defer func() { <-sem }()
-			c, ok := connMgr.Get(targetIP)
-			if !ok {
-				c = clientLib.NewClient(&fp, conf)
-				connMgr.WarmUp([]string{targetIP})
-			}
-			var url string
-			if ipv6 {
-				url = fmt.Sprintf("https://[%s]/rt/earth/PlanetoidMetadata", targetIP)
-			} else {
-				url = fmt.Sprintf("https://%s/rt/earth/PlanetoidMetadata", targetIP)
-			}
-			resp, err := c.Do("GET", url, &clientLib.RequestConfig{Method: "GET", Headers: map[string]string{"Host": host, "Accept-Encoding": "gzip", "User-Agent": "Mozilla/5.0"}, Host: host})
+			// 请求走 connMgr 中该 IP 的常驻连接（没有时由 Do 建立）
+			resp, err := connMgr.Do(context.Background(), targetIP, &clientLib.RequestConfig{Method: "GET", Path: "/rt/earth/PlanetoidMetadata", Headers: map[string]string{"Accept-Encoding": "gzip", "User-Agent": "Mozilla/5.0"}, Host: host})
 			if err == nil && resp != nil && resp.StatusCode == 200 {
 				lib.ReportStatus(host, targetIP, 200)
 				unbanned++
@@ -492,6 +486,8 @@ func warmupHost(lib *ippool.IPPoolLibrary, host string, ipv6 bool) {
 				if resp.StatusCode == 200 {
 					successAllowed++
 				}
+			} else if err != nil {
+				lib.ReportError(host, targetIP, err)
 			}
 			_ = c.Close()
 		}(ip)
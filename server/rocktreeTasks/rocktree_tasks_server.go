@@ -22,7 +22,8 @@ type RockTreeTaskServer struct {
 func NewRockTreeTaskServer() *RockTreeTaskServer {
 	// 创建 uTLS 客户端（使用默认 Chrome 指纹）
 	config := &clientLib.Config{
-		Timeout: 30 * time.Second, // 30秒超时
+		Timeout:        30 * time.Second, // 30秒超时
+		AutoDecompress: true,             // 自动解码 gzip/deflate/br 响应体
 	}
 	client := clientLib.NewClient(nil, config)
 
@@ -77,9 +78,13 @@ func (s *RockTreeTaskServer) ProcessTask(ctx context.Context, req *pb.TaskReques
 		"Referer":         "https://www.google.com/",
 	}
 
-	// 使用 uTLS 客户端发送 GET 请求
-	resp, err := s.client.Get(url, headers)
+	// 使用 uTLS 客户端发送 GET 请求（gRPC 调用方取消时中止上游请求）
+	resp, err := s.client.GetContext(ctx, url, headers)
 	if err != nil {
+		// 调用方已取消或超时，直接返回对应的 gRPC 状态
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, status.FromContextError(ctxErr).Err()
+		}
 		return &pb.TaskResponse{
 			ClientId:     req.ClientId,
 			Type:         req.Type,